@@ -0,0 +1,78 @@
+package doppel
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// RegisterAlias makes alias a second name for the target TemplateSchematic,
+// e.g. to publish stable names decoupled from the schematic's own. Get and
+// every other method taking a template name treat alias exactly like target,
+// sharing its cache entry rather than parsing a separate template. Registering
+// an existing alias again points it at the new target.
+//
+// RegisterAlias returns ErrEmptyName if either name is empty, an error matching
+// ErrSchematicNotFound if target isn't in the schematic, ErrInternalTemplate if
+// target is internal, and ErrAliasConflict if alias is itself in the schematic.
+// Aliases whose targets are removed, or which a new entry would shadow, are
+// dropped by RestoreSchematic.
+func (d *Doppel) RegisterAlias(alias, target string) error {
+	alias, target = d.normalize(alias), d.normalize(target)
+	if alias == "" || target == "" {
+		return ErrEmptyName
+	}
+
+	var aliasErr error
+	err := d.do(context.Background(), func(map[string]*cacheEntry) {
+		switch ts, ok := d.schematic[target]; {
+		case !ok:
+			aliasErr = fmt.Errorf("alias %q for %q: %w", alias, target, ErrSchematicNotFound)
+		case ts != nil && ts.Internal:
+			aliasErr = fmt.Errorf("alias %q for %q: %w", alias, target, ErrInternalTemplate)
+		case d.schematic[alias] != nil:
+			aliasErr = fmt.Errorf("alias %q for %q: %w", alias, target, ErrAliasConflict)
+		default:
+			d.aliases.Store(alias, target)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return aliasErr
+}
+
+// RemoveAlias removes an alias registered via RegisterAlias. Removing a name
+// that isn't an alias has no effect.
+func (d *Doppel) RemoveAlias(alias string) error {
+	alias = d.normalize(alias)
+	return d.do(context.Background(), func(map[string]*cacheEntry) {
+		d.aliases.Delete(alias)
+	})
+}
+
+// pruneAliases drops aliases that the schematic no longer supports, as
+// described for RegisterAlias. It must be called from the cache goroutine.
+func (d *Doppel) pruneAliases() {
+	d.aliases.Range(func(alias, target interface{}) bool {
+		ts, ok := d.schematic[target.(string)]
+		if !ok || ts != nil && ts.Internal || d.schematic[alias.(string)] != nil {
+			d.aliases.Delete(alias)
+		}
+		return true
+	})
+}
+
+// aliasesOf returns the registered aliases of each template that has any, in
+// sorted order.
+func (d *Doppel) aliasesOf() map[string][]string {
+	aliases := make(map[string][]string)
+	d.aliases.Range(func(alias, target interface{}) bool {
+		aliases[target.(string)] = append(aliases[target.(string)], alias.(string))
+		return true
+	})
+	for _, names := range aliases {
+		sort.Strings(names)
+	}
+	return aliases
+}
@@ -0,0 +1,127 @@
+package doppel
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRegisterAlias(t *testing.T) {
+	newDoppel := func(t *testing.T, opts ...CacheOption) *Doppel {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		cs := schematic.Clone()
+		cs["commonNav"].Internal = true
+		d, err := New(ctx, cs, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	t.Run("aliases share their target's cache entry", func(t *testing.T) {
+		rec := &eventRecorder{}
+		d := newDoppel(t, WithEventHook(rec.record))
+		if err := d.RegisterAlias("home", "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+
+		viaAlias, err := d.Get(context.Background(), "home")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+		if viaAlias.Lookup("body") == nil {
+			t.Error("alias did not return its target")
+		}
+		if got := rec.count(EventMiss, "withBody1"); got != 1 {
+			t.Errorf("got %d misses for withBody1, want 1", got)
+		}
+		if got := rec.count(EventMiss, "home"); got != 0 {
+			t.Errorf("got %d misses for home, want 0", got)
+		}
+
+		snap, err := d.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, es := range snap.Entries {
+			var want []string
+			if es.Name == "withBody1" {
+				want = []string{"home"}
+			}
+			if !reflect.DeepEqual(es.Aliases, want) {
+				t.Errorf("%s: got aliases %v, want %v", es.Name, es.Aliases, want)
+			}
+		}
+	})
+
+	t.Run("rejects invalid aliases", func(t *testing.T) {
+		d := newDoppel(t)
+		testCases := []struct {
+			alias, target string
+			want          error
+		}{
+			{"", "withBody1", ErrEmptyName},
+			{"home", "missing", ErrSchematicNotFound},
+			{"home", "commonNav", ErrInternalTemplate},
+			{"withBody2", "withBody1", ErrAliasConflict},
+		}
+		for _, tc := range testCases {
+			if err := d.RegisterAlias(tc.alias, tc.target); !errors.Is(err, tc.want) {
+				t.Errorf("RegisterAlias(%q, %q): got error %v, want %v", tc.alias, tc.target, err, tc.want)
+			}
+		}
+	})
+
+	t.Run("removed aliases no longer resolve", func(t *testing.T) {
+		d := newDoppel(t)
+		if err := d.RegisterAlias("home", "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.RemoveAlias("home"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Get(context.Background(), "home"); !errors.Is(err, ErrSchematicNotFound) {
+			t.Errorf("got error %v, want ErrSchematicNotFound", err)
+		}
+	})
+
+	t.Run("RestoreSchematic drops aliases it invalidates", func(t *testing.T) {
+		d := newDoppel(t)
+		for alias, target := range map[string]string{"home": "withBody1", "about": "withBody2", "kept": "base"} {
+			if err := d.RegisterAlias(alias, target); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cs := schematic.Clone()
+		delete(cs, "withBody2")
+		cs["home"] = &TemplateSchematic{Filepaths: []string{basepath}}
+		if err := d.RestoreSchematic(context.Background(), cs); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := d.aliasesOf(), map[string][]string{"base": {"kept"}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got aliases %v, want %v", got, want)
+		}
+	})
+
+	t.Run("alias names are normalized", func(t *testing.T) {
+		d := newDoppel(t, WithNameNormalizer(func(name string) string {
+			if name == "Home" {
+				return "home"
+			}
+			return name
+		}))
+		if err := d.RegisterAlias("Home", "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Get(context.Background(), "home"); err != nil {
+			t.Error(err)
+		}
+	})
+}
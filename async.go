@@ -0,0 +1,91 @@
+package doppel
+
+import (
+	"context"
+	"html/template"
+)
+
+// A Result is the outcome of a request made via GetAsync.
+type Result struct {
+	Tmpl *template.Template
+	Err  error
+}
+
+// GetAsync requests a named template from the cache without waiting for it to
+// be parsed. The returned channel receives exactly one Result, as Get would
+// return, and is then closed.
+//
+// GetAsync blocks only until the cache accepts the request. The result is
+// delivered by the cache itself, so no goroutine is started on the caller's
+// behalf. If ctx is done before the result is ready, the channel receives the
+// context's error, so a select on it never hangs.
+func (d *Doppel) GetAsync(ctx context.Context, name string) <-chan Result {
+	name = d.canonical(name)
+	resultStream := make(chan Result, 1)
+	req := &request{
+		name:        name,
+		asyncStream: resultStream,
+		start:       d.clock.Now(),
+		cancel:      func() {}, // replaced once ctx is derived
+	}
+	if d.latencyLogging {
+		req.timing = &requestTiming{}
+	}
+
+	if name == "" {
+		d.sendAsync(req, nil, ErrEmptyName)
+		return resultStream
+	}
+	select {
+	case <-d.done:
+		d.sendAsync(req, nil, ErrDoppelShutdown)
+		return resultStream
+	default:
+	}
+
+	cancelTimeout := context.CancelFunc(func() {})
+	if timeout := d.timeoutFor(name); timeout > 0 {
+		ctx, cancelTimeout = d.withTimeout(ctx, timeout)
+	}
+	// The cancellation of ctx is deferred until the result is sent, so that
+	// recursive requests for base templates are released as for Get.
+	ctx, cancel := context.WithCancel(ctx)
+	req.ctx = ctx
+	req.cancel = func() {
+		cancel()
+		cancelTimeout()
+	}
+
+	d.logQueued(req)
+	// Once the cache has shut down, a buffered send could still succeed after
+	// its final drain, so shutdown is checked again while holding enqueueMu.
+	d.enqueueMu.RLock()
+	defer d.enqueueMu.RUnlock()
+	select {
+	case <-d.done:
+		d.sendAsync(req, nil, ErrDoppelShutdown)
+		return resultStream
+	default:
+	}
+	select {
+	case <-d.done:
+		d.sendAsync(req, nil, ErrDoppelShutdown)
+	case <-ctx.Done():
+		if d.shutDown() {
+			d.sendAsync(req, nil, ErrDoppelShutdown)
+			break
+		}
+		d.sendAsync(req, nil, RequestError{ctx.Err(), name, d.since(req.start), d.logLatency(req, ctx.Err())})
+	case d.requestStream <- req:
+	}
+	return resultStream
+}
+
+// sendAsync sends the result of req to the channel returned by GetAsync,
+// closes it and releases req's context. It must be called exactly once per
+// request.
+func (d *Doppel) sendAsync(req *request, tmpl *template.Template, err error) {
+	defer req.cancel()
+	defer close(req.asyncStream)
+	req.asyncStream <- Result{Tmpl: tmpl, Err: err}
+}
@@ -0,0 +1,167 @@
+package doppel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetAsync(t *testing.T) {
+	// receive returns the single Result sent on results, failing if the channel
+	// isn't closed afterwards.
+	receive := func(t *testing.T, results <-chan Result) Result {
+		t.Helper()
+		var res Result
+		select {
+		case res = <-results:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for result")
+		}
+		select {
+		case _, ok := <-results:
+			if ok {
+				t.Error("received a second result")
+			}
+		case <-time.After(time.Second):
+			t.Error("result channel wasn't closed")
+		}
+		return res
+	}
+
+	t.Run("delivers the template", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := receive(t, d.GetAsync(context.Background(), "withBody1"))
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		if res.Tmpl.Lookup("body") == nil {
+			t.Error("returned template is missing \"body\"")
+		}
+	})
+
+	t.Run("delivers cache errors", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := receive(t, d.GetAsync(context.Background(), "missing"))
+		if !errors.Is(res.Err, ErrSchematicNotFound) {
+			t.Errorf("got error %v, want ErrSchematicNotFound", res.Err)
+		}
+		if res.Tmpl != nil {
+			t.Error("got a template alongside the error")
+		}
+	})
+
+	t.Run("delivers the context's error when canceled during parsing", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		release := make(chan struct{})
+		defer close(release)
+		slowOpen := OptionFunc(func(d *Doppel) {
+			d.open = func(string) (io.ReadCloser, error) {
+				return &slowReader{release}, nil
+			}
+		})
+		d, err := New(ctx, schematic, slowOpen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reqCtx, reqCancel := context.WithCancel(context.Background())
+		results := d.GetAsync(reqCtx, "base")
+		reqCancel()
+		if res := receive(t, results); !errors.Is(res.Err, context.Canceled) {
+			t.Errorf("got error %v, want context.Canceled", res.Err)
+		}
+	})
+
+	t.Run("delivers the context's error when already canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reqCtx, reqCancel := context.WithCancel(context.Background())
+		reqCancel()
+		if res := receive(t, d.GetAsync(reqCtx, "base")); !errors.Is(res.Err, context.Canceled) {
+			t.Errorf("got error %v, want context.Canceled", res.Err)
+		}
+	})
+
+	t.Run("delivers ErrDoppelShutdown after shutdown", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		for range d.Heartbeat() {
+		}
+
+		if res := receive(t, d.GetAsync(context.Background(), "base")); !errors.Is(res.Err, ErrDoppelShutdown) {
+			t.Errorf("got error %v, want ErrDoppelShutdown", res.Err)
+		}
+	})
+
+	t.Run("delivers a result to requests racing shutdown", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			d, err := New(context.Background(), schematic, WithRequestBuffer(64))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			results := make(chan (<-chan Result), 64)
+			for j := 0; j < cap(results); j++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					results <- d.GetAsync(context.Background(), "withBody1")
+				}()
+			}
+			d.Close()
+			wg.Wait()
+			close(results)
+			for rs := range results {
+				if res := receive(t, rs); res.Err != nil && !errors.Is(res.Err, ErrDoppelShutdown) {
+					t.Errorf("got error %v, want nil or ErrDoppelShutdown", res.Err)
+				}
+			}
+		}
+	})
+
+	t.Run("speculative requests can be selected between", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The unwanted result is buffered, so leaving it unread doesn't block
+		// the cache.
+		d.GetAsync(context.Background(), "withBody1")
+		if res := receive(t, d.GetAsync(context.Background(), "withBody2")); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package doppel
+
+import "sync/atomic"
+
+// A Backend determines how requests reach the cache, as selected via
+// WithBackend.
+type Backend int
+
+const (
+	// BackendChannel serves every request on the cache goroutine, which has
+	// exclusive access to the cache. It is the default.
+	BackendChannel Backend = iota
+
+	// BackendLocked serves requests for templates that are already parsed
+	// directly from a concurrent index of the cache, without visiting the
+	// cache goroutine, so that cache hits scale across cores. Misses, parses,
+	// retries and every other operation on the cache are handled by the cache
+	// goroutine as for BackendChannel.
+	BackendLocked
+)
+
+// defaultBackend is the Backend used unless WithBackend is supplied. Tests
+// override it to run the suite against each backend.
+var defaultBackend = BackendChannel
+
+func (b Backend) String() string {
+	switch b {
+	case BackendChannel:
+		return "channel"
+	case BackendLocked:
+		return "locked"
+	}
+	return "unknown"
+}
+
+// lookupReady serves req from the index if its template is parsed and would be
+// served unchanged by the cache goroutine, reporting whether it did so. The
+// result is the same as the cache goroutine would deliver: a clone of the
+// template or its cached error.
+func (d *Doppel) lookupReady(req *request) (result, bool) {
+	key := req.key()
+	v, ok := d.index.Load(key)
+	if !ok {
+		return result{}, false
+	}
+	ce := v.(*cacheEntry)
+	if ce.internal() {
+		return result{}, false // the cache goroutine rejects the request
+	}
+	select {
+	case <-ce.ready:
+	default:
+		return result{}, false
+	}
+	if d.devMode || d.noErrorCaching && ce.failed() {
+		return result{}, false // the cache goroutine would reparse it
+	}
+
+	d.logSampled(logRequestReceived, key)
+	if req.timing != nil {
+		req.timing.dequeued = req.start // never queued
+	}
+	select {
+	case d.pulse <- struct{}{}:
+		// The heartbeat approximates the cache goroutine's activity.
+	default:
+	}
+	if ce.stats != nil {
+		atomic.AddUint64(&ce.stats.hits, 1)
+	}
+	d.emit(EventHit, key)
+	return d.collect(ce, req) // never blocks, since ce is ready
+}
@@ -0,0 +1,117 @@
+package doppel
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+// TestMain runs the suite once for each Backend, so that both implement the
+// same behavior. Benchmarks select their backends explicitly, so they run once.
+func TestMain(m *testing.M) {
+	for _, b := range []Backend{BackendChannel, BackendLocked} {
+		defaultBackend = b
+		if code := m.Run(); code != 0 {
+			fmt.Fprintf(os.Stderr, "FAIL with backend %s\n", b)
+			os.Exit(code)
+		}
+		if flag.Lookup("test.bench").Value.String() != "" {
+			break
+		}
+	}
+	os.Exit(0)
+}
+
+func TestWithBackend(t *testing.T) {
+	t.Run("serves hits without the cache goroutine", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		rec := &eventRecorder{}
+		d, err := New(ctx, schematic, WithBackend(BackendLocked), WithEventHook(rec.record))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := d.Get(context.Background(), "withBody1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Occupy the cache goroutine until the hits have been served.
+		release := make(chan struct{})
+		occupied := make(chan struct{})
+		go d.do(context.Background(), func(map[string]*cacheEntry) {
+			close(occupied)
+			<-release
+		})
+		<-occupied
+		defer close(release)
+
+		const hits = 5
+		for i := 0; i < hits; i++ {
+			got, err := d.Get(context.Background(), "withBody1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == want {
+				t.Error("got the cached template, want a copy")
+			}
+		}
+		if got := rec.count(EventHit, "withBody1"); got != hits {
+			t.Errorf("got %d hits, want %d", got, hits)
+		}
+	})
+
+	t.Run("rejects unknown backends", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		if _, err := New(ctx, schematic, WithBackend(Backend(-1))); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("got error %v, want ErrInvalidOption", err)
+		}
+	})
+}
+
+// BenchmarkBackends compares the backends serving cache hits to a number of
+// concurrent getters.
+func BenchmarkBackends(b *testing.B) {
+	for _, backend := range []Backend{BackendChannel, BackendLocked} {
+		for _, getters := range []int{1, 8, 64} {
+			b.Run(fmt.Sprintf("%s/getters=%d", backend, getters), func(b *testing.B) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				d, err := New(ctx, schematic, WithBackend(backend))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+					b.Fatal(err)
+				}
+
+				b.ResetTimer()
+				var wg sync.WaitGroup
+				for g := 0; g < getters; g++ {
+					n := b.N / getters
+					if g < b.N%getters {
+						n++
+					}
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for i := 0; i < n; i++ {
+							if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+								b.Error(err)
+								return
+							}
+						}
+					}()
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
@@ -2,23 +2,105 @@ package doppel
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"text/template/parse"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 type cacheEntry struct {
-	ready     chan struct{}      // signals ready to return results
-	retry     chan struct{}      // signals to retry parsing in subsequent requests (e.g. after cancelletion)
-	schematic *TemplateSchematic // embedded schemaitc enables reparsing if a retry is required
-	tmpl      *template.Template // the parsed template
-	err       error              // any error encountered while parsing
+	deliveries   uint64             // number of results delivered; accessed atomically
+	name         string             // the name of the template in the schematic
+	funcs        template.FuncMap   // functions added to the base template before parsing, if any
+	stats        *templateStats     // nil for templates absent from the schematic
+	ready        chan struct{}      // signals ready to return results
+	retry        chan struct{}      // signals to retry parsing in subsequent requests (e.g. after cancelletion)
+	schematic    *TemplateSchematic // embedded schemaitc enables reparsing if a retry is required
+	includes     []string           // the files of the templates the entry includes
+	files        []string           // the cleaned paths of every file the entry is composed from, including its bases'
+	bases        []parseUnit        // the entry's base templates, root first, if they are parsed with it in a single pass
+	depth        int                // the number of templates in the entry's chain of base templates
+	tmpl         *template.Template // the parsed template
+	size         int64              // bytes of source read to parse tmpl, excluding bases cloned from other entries
+	filesParsed  int                // the number of files parsed to produce tmpl
+	parseTime    time.Duration      // the duration of the most recent parse, including retrieving the base
+	err          error              // any error encountered while parsing
+	parsedAt     time.Time          // when the template was last parsed successfully
+	parseStarted time.Time          // when the most recent parse began
+	erroredAt    time.Time          // when the most recent parse failed
+	lastErr      lastError          // the error of the most recent parse, readable while a retry is in progress
+}
+
+// A lastError holds the error of an entry's most recent parse. Unlike the
+// entry's err field, it may be read before the entry is ready.
+type lastError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (le *lastError) set(err error) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	le.err = err
+}
+
+func (le *lastError) get() error {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	return le.err
+}
+
+// internal reports whether ce's template may only be used as the base of
+// others.
+func (ce *cacheEntry) internal() bool {
+	return ce.schematic != nil && ce.schematic.Internal
+}
+
+// retryable reports whether ce's error is transient, such that parsing should
+// be retried by subsequent requests.
+func (ce *cacheEntry) retryable(retryTimeouts bool) bool {
+	return errors.Is(ce.err, context.Canceled) || retryTimeouts && errors.Is(ce.err, context.DeadlineExceeded)
+}
+
+// failed reports whether ce has finished parsing with an error that may be
+// resolved by parsing again, i.e. any error other than ErrSchematicNotFound.
+// It does not block.
+func (ce *cacheEntry) failed() bool {
+	select {
+	case <-ce.ready:
+		return ce.err != nil && !errors.Is(ce.err, ErrSchematicNotFound)
+	default:
+		return false
+	}
+}
+
+// A parseUnit is the files parsed for a single template in a chain: the files
+// of the templates it includes, followed by its own.
+type parseUnit struct {
+	includes []string
+	own      []string
+}
+
+func (pu parseUnit) files() []string {
+	files := make([]string, 0, len(pu.includes)+len(pu.own))
+	files = append(files, pu.includes...)
+	return append(files, pu.own...)
+}
+
+// lineage returns the parseUnits parsed by ce itself: its bases, if they are
+// parsed in the same pass, followed by its own.
+func (ce *cacheEntry) lineage() []parseUnit {
+	lineage := make([]parseUnit, 0, len(ce.bases)+1)
+	lineage = append(lineage, ce.bases...)
+	return append(lineage, parseUnit{ce.includes, ce.schematic.Filepaths})
 }
 
 func (ce *cacheEntry) signalStatus(retryTimeouts bool) {
-	if errors.Is(ce.err, context.Canceled) || retryTimeouts && errors.Is(ce.err, context.DeadlineExceeded) {
+	if ce.retryable(retryTimeouts) {
 		select {
 		case ce.retry <- struct{}{}:
 		default:
@@ -30,86 +112,401 @@ func (ce *cacheEntry) signalStatus(retryTimeouts bool) {
 }
 
 func (d *Doppel) parse(ce *cacheEntry, req *request) {
-	defer ce.signalStatus(d.retryTimeouts)
+	key := req.key()
+	defer func() {
+		if ce.err != nil {
+			ce.erroredAt = d.clock.Now()
+		} else {
+			ce.parsedAt = d.clock.Now()
+		}
+		ce.lastErr.set(ce.err)
+		switch {
+		case ce.retryable(d.retryTimeouts):
+			d.emit(EventRetry, key)
+		case ce.err != nil:
+			d.emit(EventParseError, key)
+		}
+		ce.signalStatus(d.retryTimeouts)
+	}()
 
 	select {
 	case <-req.ctx.Done():
-		ce.err = errors.WithStack(req.ctx.Err())
+		ce.err = req.ctx.Err()
 		return
 	default:
 	}
 
 	ce.err = nil // reset error in the event of a retry
+	ce.size, ce.filesParsed = 0, 0
+	ce.parseStarted = d.clock.Now()
+	defer func(start time.Time) {
+		ce.parseTime = d.since(start)
+		ce.stats.recordParse(ce.parseTime, ce.err)
+		if d.slowParseThreshold > 0 && ce.parseTime > d.slowParseThreshold {
+			d.log.Printf(logSlowParse, key, ce.parseTime, d.slowParseThreshold)
+			d.emit(EventSlowParse, key)
+		}
+	}(ce.parseStarted)
 
 	if ce.schematic == nil {
-		msg := fmt.Sprintf(logMissingSchematic, req.name)
-		d.log.Printf(msg)
+		d.log.Printf(logMissingSchematic, key)
 		ce.err = RequestError{
-			errors.WithStack(ErrSchematicNotFound),
-			req.name,
-			time.Since(req.start),
+			ErrSchematicNotFound,
+			key,
+			d.since(req.start),
+			nil,
+		}
+		return
+	}
+
+	if ce.schematic.BaseTmplName == "" && len(ce.schematic.Filepaths) == 0 && len(ce.includes) == 0 {
+		d.log.Printf(logParsingError, key)
+		ce.err = RequestError{
+			fmt.Errorf("template %q has no base template, files or includes: %w", ce.name, ErrEmptyTemplateSchematic),
+			key,
+			d.since(req.start),
+			nil,
+		}
+		return
+	}
+
+	if d.maxDepth > 0 && ce.depth > d.maxDepth {
+		d.log.Printf(logParsingError, key)
+		ce.err = RequestError{
+			fmt.Errorf("%d templates in chain, limit %d: %w", ce.depth, d.maxDepth, ErrMaxDepthExceeded),
+			key,
+			d.since(req.start),
+			nil,
 		}
 		return
 	}
 
 	var tmpl *template.Template
+	var size int64
+	var files int
 	var err error
-	if ce.schematic.BaseTmplName == "" {
-		tmpl, err = template.ParseFiles(ce.schematic.Filepaths...)
-	} else {
-		// Synchronize recursive requests with the original Get's timeout or
-		// cancellation. req's context can't simply be wrapped by the new one
-		// because it is a struct field that hasn't flowed down the call stack
-		// in the usual fashion.
-		d.log.Printf(logGettingBaseTemplate, ce.schematic.BaseTmplName, req.name)
-		ctx, cancel := context.WithCancel(context.Background())
-		go func() {
-			<-req.ctx.Done() // guaranteed to be closed when the parent Get returns
-			cancel()
-		}()
+	if ce.schematic.BaseTmplName == "" || len(ce.bases) > 0 {
+		// Parsing the files of each template in the chain in turn, from the
+		// root, produces the same template set as cloning each parsed base.
+		// Each unit is parsed by a separate call, so that strict definitions
+		// are checked within each template rather than across the chain.
+		lineage := ce.lineage()
 
+		// The template set is named after the root's first file, so that it is
+		// the root, rather than one of its includes, that is executed.
+		if len(lineage[0].includes) > 0 && len(lineage[0].own) > 0 {
+			tmpl = d.newTemplate(d.templateName(lineage[0].own[0]))
+		}
+		for _, pu := range lineage {
+			paths := pu.files()
+			if len(paths) == 0 && tmpl != nil {
+				continue
+			}
+			var n int64
+			if tmpl, n, err = d.parseFiles(req.ctx, tmpl, paths...); err != nil {
+				break
+			}
+			size += n
+			files += len(paths)
+		}
+	} else {
+		d.log.Printf(logGettingBaseTemplate, ce.schematic.BaseTmplName, key)
 		var base *template.Template
-		base, err = d.Get(ctx, ce.schematic.BaseTmplName)
+		base, err = d.getBase(req, ce.schematic.BaseTmplName)
 		if err != nil {
 			ce.err = err
 			return
 		}
 
-		tmpl, err = base.ParseFiles(ce.schematic.Filepaths...)
+		if ce.funcs != nil {
+			base.Funcs(ce.funcs)
+		}
+		own := parseUnit{ce.includes, ce.schematic.Filepaths}
+		if len(own.files()) == 0 {
+			// Aliases, and locale variants consisting of functions alone, are
+			// clones of their base.
+			tmpl = base
+		} else {
+			tmpl, size, err = d.parseFiles(req.ctx, base, own.files()...)
+			files = len(own.files())
+		}
 	}
 
 	if err != nil {
-		d.log.Printf(logParsingError, req.name)
-		ce.err = RequestError{err, req.name, time.Since(req.start)}
+		d.log.Printf(logParsingError, key)
+		ce.err = RequestError{d.transformParseError(err), key, d.since(req.start), nil}
 		return
 	}
-	d.log.Printf(logParsingSuccess, req.name)
+	d.log.Printf(logParsingSuccess, key)
 	ce.tmpl = tmpl
+	ce.size, ce.filesParsed = size, files
+}
+
+// transformParseError applies the transform set via WithParseErrorTransform,
+// if any, to err, unless err is the result of a cancellation or timeout.
+func (d *Doppel) transformParseError(err error) error {
+	if d.transformParseErr == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	if transformed := d.transformParseErr(err); transformed != nil {
+		return transformed
+	}
+	return err
+}
+
+// parseFiles behaves like template.ParseFiles and
+// (*template.Template).ParseFiles, associating each file with t by the name
+// given by d.templateName, but reads files via readFile so that slow reads can
+// be preempted. If t is nil, the first file's template is used as the root,
+// allocated via newTemplate. parseFiles also returns the total size of the
+// files read.
+//
+// If strict definitions are enabled, parseFiles fails with
+// ErrDuplicateDefinition if any template name is defined by more than one of
+// the files at paths.
+func (d *Doppel) parseFiles(ctx context.Context, t *template.Template, paths ...string) (*template.Template, int64, error) {
+	if len(paths) == 0 {
+		return nil, 0, errors.New("html/template: no files named in call to ParseFiles")
+	}
+
+	var size int64
+	var definedIn map[string]string
+	if d.strictDefinitions {
+		definedIn = make(map[string]string)
+	}
+	for _, path := range paths {
+		src, err := d.readFile(ctx, path)
+		if err != nil {
+			return nil, 0, err
+		}
+		size += int64(len(src))
+
+		name := d.templateName(path)
+		var tmpl *template.Template
+		if t == nil {
+			t = d.newTemplate(name)
+		}
+		if name == t.Name() {
+			tmpl = t
+		} else {
+			tmpl = t.New(name)
+		}
+		var trees map[string]*parse.Tree
+		if definedIn != nil {
+			trees = treesOf(t)
+		}
+		if _, err := tmpl.Parse(string(src)); err != nil {
+			return nil, 0, err
+		}
+		if definedIn == nil {
+			continue
+		}
+		// Parse replaces the tree of each template the file defines.
+		for _, defined := range t.Templates() {
+			name := defined.Name()
+			if defined.Tree == nil || defined.Tree == trees[name] {
+				continue
+			}
+			if prev, ok := definedIn[name]; ok && prev != path {
+				return nil, 0, fmt.Errorf("%q defined in %s and %s: %w", name, prev, path, ErrDuplicateDefinition)
+			}
+			definedIn[name] = path
+		}
+	}
+	return t, size, nil
+}
+
+// treesOf returns the parse tree of each template associated with t, by name.
+func treesOf(t *template.Template) map[string]*parse.Tree {
+	trees := make(map[string]*parse.Tree)
+	for _, tmpl := range t.Templates() {
+		trees[tmpl.Name()] = tmpl.Tree
+	}
+	return trees
+}
+
+// newTemplate allocates a new template with the given name and the functions
+// registered via WithFuncs, if any.
+func (d *Doppel) newTemplate(name string) *template.Template {
+	tmpl := template.New(name)
+	if d.funcs != nil {
+		tmpl.Funcs(d.funcs)
+	}
+	return tmpl
+}
+
+// readFile returns the contents of the file at path, or ctx's error if ctx is
+// done or the read timeout, if any, expires before the read completes, or
+// ErrDoppelShutdown if the Doppel shuts down first. Go offers no way to
+// interrupt a blocking read, so a preempted read is abandoned to finish in the
+// background.
+func (d *Doppel) readFile(ctx context.Context, path string) ([]byte, error) {
+	if d.readTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = d.withTimeout(ctx, d.readTimeout)
+		defer cancel()
+	}
+
+	type readResult struct {
+		src []byte
+		err error
+	}
+
+	resultStream := make(chan readResult, 1) // buffered so abandoned reads can exit
+	go func() {
+		f, err := d.open(path)
+		if err != nil {
+			resultStream <- readResult{err: err}
+			return
+		}
+		defer f.Close()
+
+		src, err := ioutil.ReadAll(f)
+		resultStream <- readResult{src, err}
+	}()
+
+	select {
+	case <-d.done:
+		return nil, ErrDoppelShutdown
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-resultStream:
+		return res.src, res.err
+	}
+}
+
+// getBase fetches the named base template on behalf of parent, which is
+// parsing a template composed from it. Unlike Get, getBase shares parent's
+// context and waits for the base's cache entry itself, rather than via a
+// separate delivery goroutine, so that each level of a chain of base templates
+// costs a single goroutine.
+func (d *Doppel) getBase(parent *request, name string) (*template.Template, error) {
+	entryStream := make(chan *cacheEntry, 1) // buffered so the cache never blocks
+	req := &request{
+		name:        name,
+		entryStream: entryStream,
+		start:       d.clock.Now(),
+		ctx:         parent.ctx,
+	}
+
+	d.logQueued(req)
+	select {
+	case <-d.done:
+		return nil, ErrDoppelShutdown
+	case <-req.ctx.Done():
+		return nil, RequestError{
+			req.ctx.Err(),
+			req.name,
+			d.since(req.start),
+			nil,
+		}
+	case d.requestStream <- req:
+	}
+
+	var ce *cacheEntry
+	select {
+	case <-req.ctx.Done():
+		return nil, req.ctx.Err()
+	case <-d.done:
+		return nil, ErrDoppelShutdown
+	case ce = <-entryStream:
+	}
+
+	res, ok := d.collect(ce, req)
+	if !ok {
+		if d.shutDown() {
+			return nil, ErrDoppelShutdown
+		}
+		return nil, req.ctx.Err()
+	}
+	return d.result(req, res)
 }
 
 func (d *Doppel) deliver(ce *cacheEntry, req *request) {
-loop:
-	for {
-		select {
-		case <-req.ctx.Done():
-			d.log.Printf(logRequestInterrupted, req.name)
+	res, ok := d.collect(ce, req)
+	if req.asyncStream != nil {
+		if !ok {
+			if d.shutDown() {
+				d.sendAsync(req, nil, ErrDoppelShutdown)
+				return
+			}
+			d.logLatency(req, req.ctx.Err())
+			d.sendAsync(req, nil, req.ctx.Err())
 			return
-		case <-ce.retry:
-			go d.parse(ce, req)
-		case <-ce.ready:
-			break loop
 		}
+		tmpl, err := d.result(req, res)
+		d.sendAsync(req, tmpl, err)
+		return
+	}
+	if ok {
+		req.resultStream <- res
+	}
+}
+
+// collect waits for ce to be ready and returns its result for req: a clone of
+// its template or its error. It reports false if req is canceled or the Doppel
+// shuts down first.
+func (d *Doppel) collect(ce *cacheEntry, req *request) (result, bool) {
+	key := req.key()
+
+	// Once ready is closed, an entry can never be retried, so cache hits skip
+	// waiting on the retry channel.
+	select {
+	case <-ce.ready:
+	default:
+		if !d.awaitReady(ce, req) {
+			d.log.Printf(logRequestInterrupted, key)
+			return result{}, false
+		}
+	}
+
+	if t := req.timing; t != nil {
+		t.parseStarted = ce.parseStarted
+		t.parseEnded = ce.parsedAt
+		if ce.err != nil {
+			t.parseEnded = ce.erroredAt
+		}
+		t.cloneStarted = d.clock.Now()
 	}
 
 	if ce.err != nil {
-		d.log.Printf(logDeliveringCachedError, req.name)
-		req.resultStream <- &result{err: ce.err}
-		return
+		d.log.Printf(logDeliveringCachedError, key)
+		atomic.AddUint64(&ce.deliveries, 1)
+		d.delivered(ce, req)
+		return result{err: ce.err}, true
 	}
 
 	// Return a copy of the template that can be safely executed
 	// without affecting cached templates.
-	d.log.Printf(logDeliveringTemplate, req.name)
+	d.logSampled(logDeliveringTemplate, key)
 	clone, _ := ce.tmpl.Clone()
-	req.resultStream <- &result{tmpl: clone}
+	atomic.AddUint64(&ce.deliveries, 1)
+	d.delivered(ce, req)
+	return result{tmpl: clone}, true
+}
+
+// delivered records the time of a delivery of ce to req.
+func (d *Doppel) delivered(ce *cacheEntry, req *request) {
+	now := d.clock.Now()
+	ce.stats.recordDelivery(now)
+	if req.timing != nil {
+		req.timing.delivered = now
+	}
+}
+
+// awaitReady blocks until ce is ready, reparsing it whenever a retry is
+// signaled. It reports false if req is canceled or the Doppel shuts down first.
+func (d *Doppel) awaitReady(ce *cacheEntry, req *request) bool {
+	for {
+		select {
+		case <-d.done:
+			return false
+		case <-req.ctx.Done():
+			return false
+		case <-ce.retry:
+			go d.parse(ce, req)
+		case <-ce.ready:
+			return true
+		}
+	}
 }
@@ -2,9 +2,8 @@ package doppel
 
 import (
 	"context"
+	"errors"
 	"testing"
-
-	"github.com/pkg/errors"
 )
 
 func TestSignalStatus(t *testing.T) {
@@ -53,3 +52,38 @@ func TestSignalStatus(t *testing.T) {
 		}
 	})
 }
+
+// BenchmarkCollectReady isolates the check collect makes before delivering a
+// ready entry, comparing the fast path for entries that are already ready with
+// the select that awaits retries.
+func BenchmarkCollectReady(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d, err := New(ctx, schematic)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ce := &cacheEntry{ready: make(chan struct{}), retry: make(chan struct{})}
+	close(ce.ready)
+	reqCtx, reqCancel := context.WithCancel(context.Background())
+	defer reqCancel()
+	req := &request{name: "withBody1", ctx: reqCtx}
+
+	b.Run("fast path", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			select {
+			case <-ce.ready:
+			default:
+				d.awaitReady(ce, req)
+			}
+		}
+	})
+	b.Run("select", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			d.awaitReady(ce, req)
+		}
+	})
+}
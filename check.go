@@ -0,0 +1,113 @@
+package doppel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"path/filepath"
+)
+
+// errBaseInvalid marks templates that couldn't be checked because their base
+// template failed to parse, so that only the base's failure is reported.
+var errBaseInvalid = errors.New("base template failed to parse")
+
+// CheckSchematic parses every template in cs, composing each from its base
+// template and includes as a Doppel would, without starting a cache. The
+// parsed templates are discarded. It is intended as a pre-deploy check that
+// every template compiles.
+//
+// CheckSchematic returns nil only if every template parses. Schematics that a
+// Doppel would reject outright, such as cyclic schematics, produce the same
+// errors as New. Otherwise, parse failures are aggregated into a single error
+// matching ErrInvalidTemplates that lists each failing template, and that also
+// matches each template's underlying error via errors.Is. Templates
+// whose base fails to parse are not reported separately. If ctx is done
+// before checking completes, CheckSchematic returns ctx's error.
+func CheckSchematic(ctx context.Context, cs CacheSchematic) error {
+	if cyclic, err := IsCyclic(cs); cyclic {
+		return err
+	}
+	if err := cs.validate(false); err != nil {
+		return err
+	}
+
+	c := newSchematicChecker(&Doppel{open: openFile, templateName: filepath.Base}, cs)
+	var failed []error
+	for _, name := range cs.names() {
+		_, err := c.check(ctx, name)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && !errors.Is(err, errBaseInvalid) {
+			failed = append(failed, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidTemplates, errors.Join(failed...))
+}
+
+type checkResult struct {
+	tmpl *template.Template
+	err  error
+}
+
+// A schematicChecker parses the templates of a CacheSchematic, memoizing each
+// result so that shared base templates are parsed once.
+type schematicChecker struct {
+	d       *Doppel // supplies parseFiles; its cache, if any, is not used
+	cs      CacheSchematic
+	results map[string]checkResult
+}
+
+func newSchematicChecker(d *Doppel, cs CacheSchematic) *schematicChecker {
+	return &schematicChecker{d: d, cs: cs, results: make(map[string]checkResult, len(cs))}
+}
+
+// check returns the named template, parsed and composed from its base
+// template and includes. Callers must clone the template before executing it,
+// since it may serve as the base of others.
+func (c *schematicChecker) check(ctx context.Context, name string) (*template.Template, error) {
+	if res, ok := c.results[name]; ok {
+		return res.tmpl, res.err
+	}
+
+	tmpl, err := c.parse(ctx, name)
+	c.results[name] = checkResult{tmpl, err}
+	return tmpl, err
+}
+
+func (c *schematicChecker) parse(ctx context.Context, name string) (*template.Template, error) {
+	ts := c.cs[name]
+	own := parseUnit{c.cs.includedFiles(name), ts.Filepaths}
+
+	if ts.BaseTmplName == "" && len(own.files()) == 0 {
+		return nil, fmt.Errorf("template %q has no base template, files or includes: %w", name, ErrEmptyTemplateSchematic)
+	}
+
+	var root *template.Template
+	switch {
+	case ts.BaseTmplName != "":
+		if c.cs[ts.BaseTmplName] == nil {
+			return nil, fmt.Errorf("base %q: %w", ts.BaseTmplName, ErrSchematicNotFound)
+		}
+		base, err := c.check(ctx, ts.BaseTmplName)
+		if err != nil {
+			return nil, errBaseInvalid
+		}
+		if root, err = base.Clone(); err != nil {
+			return nil, err
+		}
+		if len(own.files()) == 0 {
+			return root, nil // an alias of its base
+		}
+	case len(own.includes) > 0 && len(own.own) > 0:
+		// As when parsing for the cache, the root is the template's first
+		// file rather than one of its includes.
+		root = c.d.newTemplate(c.d.templateName(own.own[0]))
+	}
+	tmpl, _, err := c.d.parseFiles(ctx, root, own.files()...)
+	return tmpl, err
+}
@@ -0,0 +1,117 @@
+package doppel
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCheckSchematic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	brokenPath := filepath.Join(dir, "broken.gohtml")
+	if err := ioutil.WriteFile(brokenPath, []byte(`{{define "body"}}unclosed`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("valid schematic", func(t *testing.T) {
+		if err := CheckSchematic(context.Background(), schematic); err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+	})
+
+	t.Run("every failing template is reported", func(t *testing.T) {
+		broken := schematic.Clone()
+		broken["withBody1"].Filepaths = []string{brokenPath}
+		broken["withBody2"].Filepaths = []string{brokenPath}
+		broken["orphan"] = &TemplateSchematic{BaseTmplName: "missing", Filepaths: []string{body1Path}}
+
+		err := CheckSchematic(context.Background(), broken)
+		if !errors.Is(err, ErrInvalidTemplates) {
+			t.Fatalf("got error %v, want ErrInvalidTemplates", err)
+		}
+		for _, name := range []string{"withBody1", "withBody2", "orphan"} {
+			if !strings.Contains(err.Error(), name+":") {
+				t.Errorf("error %q does not report %q", err, name)
+			}
+		}
+		for _, name := range []string{"base", "commonNav"} {
+			if strings.Contains(err.Error(), name+":") {
+				t.Errorf("error %q reports valid template %q", err, name)
+			}
+		}
+		if got, want := failedTemplates(t, err), []string{"orphan", "withBody1", "withBody2"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got errors for %v, want %v", got, want)
+		}
+	})
+
+	t.Run("templates are not reported for a failing base", func(t *testing.T) {
+		broken := schematic.Clone()
+		broken["commonNav"].Filepaths = []string{brokenPath}
+
+		err := CheckSchematic(context.Background(), broken)
+		if !errors.Is(err, ErrInvalidTemplates) {
+			t.Fatalf("got error %v, want ErrInvalidTemplates", err)
+		}
+		if !strings.Contains(err.Error(), "commonNav:") {
+			t.Errorf("error %q does not report commonNav", err)
+		}
+		for _, name := range []string{"withBody1", "withBody2"} {
+			if strings.Contains(err.Error(), name) {
+				t.Errorf("error %q reports %q, whose base failed", err, name)
+			}
+		}
+	})
+
+	t.Run("cyclic schematic", func(t *testing.T) {
+		cyclic := schematic.Clone()
+		cyclic["base"].BaseTmplName = "withBody1"
+		if err := CheckSchematic(context.Background(), cyclic); err == nil {
+			t.Error("got nil error for cyclic schematic")
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := CheckSchematic(ctx, schematic); !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v, want context.Canceled", err)
+		}
+	})
+}
+
+// failedTemplates returns the names of the templates whose errors are
+// aggregated by err, as returned by CheckSchematic and WarmErr, in sorted order.
+func failedTemplates(t *testing.T, err error) []string {
+	t.Helper()
+	outer, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("error %v does not wrap multiple errors", err)
+	}
+	wrapped := outer.Unwrap()
+	joined, ok := wrapped[len(wrapped)-1].(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("error %v does not join the errors of each template", err)
+	}
+
+	var names []string
+	for _, err := range joined.Unwrap() {
+		name, _, ok := strings.Cut(err.Error(), ": ")
+		if !ok {
+			t.Fatalf("error %q does not name its template", err)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
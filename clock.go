@@ -0,0 +1,114 @@
+package doppel
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Clock provides the current time and timers to a Doppel. The default Clock
+// uses the system time; alternative implementations allow time-dependent
+// behavior, such as timeouts, to be tested without sleeping.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// A Timer sends the current time on its channel once it expires, unless
+// stopped first.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (rt realTimer) C() <-chan time.Time {
+	return rt.Timer.C
+}
+
+// since returns the time elapsed since t according to the Doppel's clock.
+func (d *Doppel) since(t time.Time) time.Duration {
+	return d.clock.Now().Sub(t)
+}
+
+// withTimeout behaves like context.WithTimeout, but measures the timeout using
+// the Doppel's clock.
+func (d *Doppel) withTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := d.clock.(realClock); ok {
+		return context.WithTimeout(parent, timeout)
+	}
+
+	ctx := &clockCtx{
+		Context:  parent,
+		deadline: d.clock.Now().Add(timeout),
+		done:     make(chan struct{}),
+	}
+	if parentDeadline, ok := parent.Deadline(); ok && parentDeadline.Before(ctx.deadline) {
+		ctx.deadline = parentDeadline
+	}
+
+	timer := d.clock.NewTimer(timeout)
+	stop := make(chan struct{})
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-parent.Done():
+			ctx.finish(parent.Err())
+		case <-timer.C():
+			ctx.finish(context.DeadlineExceeded)
+		case <-stop:
+			ctx.finish(context.Canceled)
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// clockCtx is a context whose deadline is measured by a Clock. It provides its
+// own Done channel, rather than embedding a context that could be canceled,
+// so that contexts derived from it observe its error when it expires.
+type clockCtx struct {
+	context.Context // provides Value
+	deadline        time.Time
+	done            chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (cc *clockCtx) Deadline() (time.Time, bool) {
+	return cc.deadline, true
+}
+
+func (cc *clockCtx) Done() <-chan struct{} {
+	return cc.done
+}
+
+func (cc *clockCtx) Err() error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.err
+}
+
+func (cc *clockCtx) finish(err error) {
+	cc.mu.Lock()
+	cc.err = err
+	cc.mu.Unlock()
+	close(cc.done)
+}
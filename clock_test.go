@@ -0,0 +1,137 @@
+package doppel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only changes when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) NewTimer(d time.Duration) Timer {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	ft := &fakeTimer{c: make(chan time.Time, 1), deadline: fc.now.Add(d)}
+	fc.timers = append(fc.timers, ft)
+	return ft
+}
+
+// Advance moves the clock forward by d, firing any timers that expire.
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.now = fc.now.Add(d)
+	for _, ft := range fc.timers {
+		ft.fire(fc.now)
+	}
+}
+
+// Timers returns the number of timers created by the clock.
+func (fc *fakeClock) Timers() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return len(fc.timers)
+}
+
+type fakeTimer struct {
+	mu       sync.Mutex
+	c        chan time.Time
+	deadline time.Time
+	done     bool // fired or stopped
+}
+
+func (ft *fakeTimer) C() <-chan time.Time {
+	return ft.c
+}
+
+func (ft *fakeTimer) Stop() bool {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	wasActive := !ft.done
+	ft.done = true
+	return wasActive
+}
+
+func (ft *fakeTimer) fire(now time.Time) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if !ft.done && !now.Before(ft.deadline) {
+		ft.done = true
+		ft.c <- now
+	}
+}
+
+// waitFor polls cond until it returns true or a second elapses.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(1 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	t.Run("request durations are measured by the clock", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		const readDuration = 3 * time.Second
+		clk := newFakeClock()
+		slowFailingOpen := OptionFunc(func(d *Doppel) {
+			d.open = func(string) (io.ReadCloser, error) {
+				clk.Advance(readDuration)
+				return nil, errors.New("read failed")
+			}
+		})
+
+		d, err := New(ctx, schematic, WithClock(clk), slowFailingOpen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = d.Get(context.Background(), "base")
+		var reqErr RequestError
+		if !errors.As(err, &reqErr) {
+			t.Fatalf("want RequestError, got: %v", err)
+		}
+		if reqErr.RequestDuration != readDuration {
+			t.Errorf("got RequestDuration %v, want %v", reqErr.RequestDuration, readDuration)
+		}
+	})
+
+	t.Run("derived contexts observe clock deadlines", func(t *testing.T) {
+		clk := newFakeClock()
+		d := &Doppel{clock: clk}
+		parent, cancel := d.withTimeout(context.Background(), time.Minute)
+		defer cancel()
+		child, cancelChild := context.WithCancel(parent)
+		defer cancelChild()
+
+		clk.Advance(time.Minute)
+		<-child.Done()
+		if !errors.Is(child.Err(), context.DeadlineExceeded) {
+			t.Errorf("want context.DeadlineExceeded, got: %v", child.Err())
+		}
+	})
+}
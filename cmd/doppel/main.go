@@ -0,0 +1,76 @@
+// Command doppel checks doppel schematics without starting an application,
+// e.g. in CI.
+//
+// Usage:
+//
+//	doppel validate [-base-dir dir] schematic
+//	doppel graph schematic
+//
+// The validate subcommand prints each problem with the schematic and exits
+// with status 1 if there are any. If -base-dir is given, it also checks that
+// every template file exists, resolving relative paths against dir. The graph
+// subcommand prints the schematic as a DOT graph for rendering with Graphviz.
+//
+// Schematics are read from JSON files, identified by the .json extension, or
+// from files in the text format read by doppel.ParseSchematicText.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/angusgmorrison/doppel"
+)
+
+const usage = `usage:
+	doppel validate [-base-dir dir] schematic
+	doppel graph schematic`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the subcommand named by args[0], returning the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "validate" && args[0] != "graph" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprintln(stderr, usage) }
+	var baseDir string
+	if args[0] == "validate" {
+		fs.StringVar(&baseDir, "base-dir", "", "check that template files exist, relative to `dir`")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	cs, err := doppel.LoadSchematic(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "validate":
+		if err := doppel.ValidateSchematic(cs, baseDir); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	case "graph":
+		if err := cs.WriteDOT(stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	return 0
+}
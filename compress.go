@@ -0,0 +1,110 @@
+package doppel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WriteCompressed renders the named template with data as for ExecuteCached,
+// bounded by r's context, and writes the output to w. If r accepts gzip
+// encoding, the output is gzip-compressed and sent with a Content-Encoding
+// header; otherwise it is sent uncompressed. When the Doppel was configured
+// with WithRenderCompression, compressed output is served directly from the
+// render cache.
+//
+// WriteCompressed sets Vary: Accept-Encoding, and sets a Content-Type of
+// text/html if none has been set, since compressed output can't be sniffed.
+func (d *Doppel) WriteCompressed(w http.ResponseWriter, r *http.Request, name, key string, data interface{}) error {
+	out, compressed, err := d.renderStored(r.Context(), name, key, data)
+	if err != nil {
+		return err
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Accept-Encoding")
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "text/html; charset=utf-8")
+	}
+
+	gz := acceptsGzip(r)
+	switch {
+	case gz && !compressed:
+		out, err = gzipBytes(out)
+	case !gz && compressed:
+		out, err = gunzip(out)
+	}
+	if err != nil {
+		return err
+	}
+	if gz {
+		h.Set("Content-Encoding", "gzip")
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(out)))
+	_, err = w.Write(out)
+	return err
+}
+
+// acceptsGzip reports whether r's Accept-Encoding header permits a gzip
+// response. An explicit gzip coding takes precedence over "*", wherever each
+// appears in the header.
+func acceptsGzip(r *http.Request) bool {
+	var gzipSeen, gzipOK, anyOK bool
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(header, ",") {
+			params := strings.Split(coding, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			if name != "gzip" && name != "*" {
+				continue
+			}
+
+			accepted := true
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					q, err := strconv.ParseFloat(param[2:], 64)
+					accepted = err == nil && q > 0
+				}
+			}
+			if name == "gzip" {
+				gzipSeen, gzipOK = true, accepted
+			} else {
+				anyOK = accepted
+			}
+		}
+	}
+	if gzipSeen {
+		return gzipOK
+	}
+	return anyOK
+}
+
+func gzipBytes(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(p); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzip(p []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(p))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	out, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
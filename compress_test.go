@@ -0,0 +1,134 @@
+package doppel
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteCompressed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	plain, err := New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := plain.Execute(context.Background(), &want, "withBody1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc           string
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{"gzip accepted", "gzip, deflate", true},
+		{"any encoding accepted", "*", true},
+		{"gzip refused", "gzip;q=0, deflate", false},
+		{"gzip refused despite any encoding", "*;q=1, gzip;q=0", false},
+		{"gzip accepted despite no other encoding", "*;q=0, gzip", true},
+		{"no encodings accepted", "", false},
+	}
+
+	for _, opts := range [][]CacheOption{
+		nil,
+		{WithRenderCache(time.Hour, 10)},
+		{WithRenderCache(time.Hour, 10), WithRenderCompression()},
+	} {
+		d, err := New(ctx, schematic, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.desc, func(t *testing.T) {
+				// Render twice, to exercise both cache misses and hits.
+				for i := 0; i < 2; i++ {
+					r := httptest.NewRequest(http.MethodGet, "/", nil)
+					if tc.acceptEncoding != "" {
+						r.Header.Set("Accept-Encoding", tc.acceptEncoding)
+					}
+					w := httptest.NewRecorder()
+					if err := d.WriteCompressed(w, r, "withBody1", "k", nil); err != nil {
+						t.Fatal(err)
+					}
+
+					body := w.Body.Bytes()
+					if gotGzip := w.Header().Get("Content-Encoding") == "gzip"; gotGzip != tc.wantGzip {
+						t.Fatalf("got gzip encoding %t, want %t", gotGzip, tc.wantGzip)
+					}
+					if tc.wantGzip {
+						if body, err = gunzip(body); err != nil {
+							t.Fatal(err)
+						}
+					}
+					if string(body) != want.String() {
+						t.Errorf("got body %q, want %q", body, want.String())
+					}
+					if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+						t.Errorf("got Vary %q, want Accept-Encoding", got)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestWithRenderCompression(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, schematic, WithRenderCache(time.Hour, 10), WithRenderCompression())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want bytes.Buffer
+	if err := d.Execute(context.Background(), &want, "withBody1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("stores compressed output", func(t *testing.T) {
+		if _, err := d.RenderCached(context.Background(), "withBody1", "k", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var stored []byte
+		err := d.do(context.Background(), func(map[string]*cacheEntry) {
+			stored = d.renders.get(renderKey{"withBody1", "k"}, d.clock.Now())
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := gunzip(stored)
+		if err != nil {
+			t.Fatalf("stored output is not gzip-compressed: %v", err)
+		}
+		if string(out) != want.String() {
+			t.Errorf("got stored output %q, want %q", out, want.String())
+		}
+	})
+
+	t.Run("ExecuteCached and RenderCached decompress output", func(t *testing.T) {
+		out, err := d.RenderCached(context.Background(), "withBody1", "k", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != want.String() {
+			t.Errorf("RenderCached: got %q, want %q", out, want.String())
+		}
+
+		var buf bytes.Buffer
+		if err := d.ExecuteCached(context.Background(), &buf, "withBody1", "k", nil); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want.String() {
+			t.Errorf("ExecuteCached: got %q, want %q", buf.String(), want.String())
+		}
+	})
+}
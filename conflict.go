@@ -0,0 +1,49 @@
+package doppel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An optionConflict describes a combination of CacheOptions that interact
+// badly. Options with constraints on other options register them in
+// optionConflicts.
+type optionConflict struct {
+	options []string           // the names of the conflicting options
+	reason  string             // why the combination is rejected
+	applies func(*Doppel) bool // reports whether the Doppel's configuration exhibits the conflict
+}
+
+// optionConflicts is the compatibility matrix checked by New once every option
+// has been applied.
+var optionConflicts = []optionConflict{
+	{
+		options: []string{"WithDevMode", "WithRenderCache"},
+		reason:  "rendered output is never cached in dev mode",
+		applies: func(d *Doppel) bool { return d.devMode && d.renders != nil },
+	},
+	{
+		options: []string{"WithDevMode", "WithRetryTimeouts"},
+		reason:  "errors are never cached in dev mode, so there is nothing to retry",
+		applies: func(d *Doppel) bool { return d.devMode && d.retryTimeouts },
+	},
+}
+
+// checkConflicts returns an error matching ErrConflictingOptions that lists
+// every conflict in the Doppel's configuration, or nil if there are none.
+func (d *Doppel) checkConflicts() error {
+	if d.allowConflicts {
+		return nil
+	}
+
+	var found []string
+	for _, c := range optionConflicts {
+		if c.applies(d) {
+			found = append(found, fmt.Sprintf("%s: %s", strings.Join(c.options, " and "), c.reason))
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", strings.Join(found, "; "), ErrConflictingOptions)
+}
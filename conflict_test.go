@@ -0,0 +1,77 @@
+package doppel
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionConflicts(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		opts      []CacheOption
+		conflicts []string // options expected to be named in the error
+	}{
+		{
+			desc: "compatible options",
+			opts: []CacheOption{WithDevMode(), WithStrictDefinitions()},
+		},
+		{
+			desc:      "WithDevMode and WithRenderCache",
+			opts:      []CacheOption{WithDevMode(), WithRenderCache(time.Minute, 10)},
+			conflicts: []string{"WithDevMode and WithRenderCache"},
+		},
+		{
+			desc:      "WithDevMode and WithRetryTimeouts",
+			opts:      []CacheOption{WithRetryTimeouts(), WithDevMode()},
+			conflicts: []string{"WithDevMode and WithRetryTimeouts"},
+		},
+		{
+			desc: "every conflict is reported",
+			opts: []CacheOption{WithDevMode(), WithRenderCache(time.Minute, 10), WithRetryTimeouts()},
+			conflicts: []string{
+				"WithDevMode and WithRenderCache",
+				"WithDevMode and WithRetryTimeouts",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			_, err := New(ctx, schematic, tc.opts...)
+			if len(tc.conflicts) == 0 {
+				if err != nil {
+					t.Errorf("got error %v, want nil", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrConflictingOptions) {
+				t.Fatalf("got error %v, want ErrConflictingOptions", err)
+			}
+			for _, conflict := range tc.conflicts {
+				if !strings.Contains(err.Error(), conflict) {
+					t.Errorf("error %q does not report conflict %q", err, conflict)
+				}
+			}
+
+			allowed := append(tc.opts, WithUnsafeAllowConflicts())
+			if _, err := New(ctx, schematic, allowed...); err != nil {
+				t.Errorf("WithUnsafeAllowConflicts: got error %v, want nil", err)
+			}
+		})
+	}
+
+	t.Run("no conflict applies to the default configuration", func(t *testing.T) {
+		for _, c := range optionConflicts {
+			if c.applies(&Doppel{}) {
+				t.Errorf("%v: conflict applies to the default configuration", c.options)
+			}
+		}
+	})
+}
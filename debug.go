@@ -0,0 +1,53 @@
+package doppel
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// DebugHandler returns an http.Handler that serves the Doppel's CacheSnapshot
+// as indented JSON. The handler may be mounted at any path.
+//
+// The query parameter name restricts the output to the named entry, and
+// errors=1 restricts it to entries in an error state. If the cache has shut
+// down, the handler responds with 503 Service Unavailable.
+func (d *Doppel) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		snap, err := d.Snapshot(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		query := r.URL.Query()
+		name := query.Get("name")
+		if name != "" {
+			name = d.canonical(name)
+		}
+		onlyErrors := query.Get("errors") == "1"
+		if name != "" || onlyErrors {
+			filtered := snap.Entries[:0]
+			for _, es := range snap.Entries {
+				if name != "" && es.Name != name {
+					continue
+				}
+				if onlyErrors && es.State != StateError {
+					continue
+				}
+				filtered = append(filtered, es)
+			}
+			snap.Entries = filtered
+		}
+
+		body, err := json.MarshalIndent(snap, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
@@ -0,0 +1,78 @@
+package doppel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testSchematic := schematic.Clone()
+	testSchematic["error"] = &TemplateSchematic{Filepaths: []string{"missing"}}
+	d, err := New(ctx, testSchematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"withBody1", "error"} {
+		d.Get(context.Background(), name)
+	}
+
+	testCases := []struct {
+		desc      string
+		query     string
+		wantNames []string
+	}{
+		{"serves every entry", "", []string{"base", "commonNav", "error", "withBody1"}},
+		{"filters by name", "?name=withBody1", []string{"withBody1"}},
+		{"filters by error state", "?errors=1", []string{"error"}},
+		{"combines filters", "?name=withBody1&errors=1", []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/debug/doppel"+tc.query, nil)
+			d.DebugHandler().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("got Cache-Control %q, want \"no-store\"", got)
+			}
+
+			var snap CacheSnapshot
+			if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+				t.Fatal(err)
+			}
+			if len(snap.Entries) != len(tc.wantNames) {
+				t.Fatalf("got %d entries, want %v", len(snap.Entries), tc.wantNames)
+			}
+			for i, es := range snap.Entries {
+				if es.Name != tc.wantNames[i] {
+					t.Errorf("got entry %q, want %q", es.Name, tc.wantNames[i])
+				}
+			}
+		})
+	}
+
+	t.Run("responds 503 if the cache is closed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+
+		rec := httptest.NewRecorder()
+		d.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+		}
+	})
+}
@@ -4,11 +4,15 @@ package doppel
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 // A Doppel provides a mechanism to configure, send requests to and
@@ -20,54 +24,204 @@ import (
 // program ends, a timeout expires, or a memory threshold has been
 // reached, per user configuration via functional options.
 type Doppel struct {
-	globalTimeout time.Duration
-	schematic     CacheSchematic
-	heartbeat     chan struct{}   // signals the start of each work loop
-	requestStream chan<- *request // sends requests to the work loop
-	done          <-chan struct{} // signals that the cache has shut down
-	log           logger
-	retryTimeouts bool // flags whether to retry parsing templates that have previously timed out
+	globalTimeout       time.Duration
+	templateTimeouts    map[string]time.Duration // per-template limits applied alongside globalTimeout
+	normalizeName       func(name string) string // puts template names into canonical form; nil if names are used as given
+	schematic           CacheSchematic
+	heartbeat           chan struct{}      // signals the start of each work loop
+	started             chan struct{}      // closed when the cache goroutine enters its work loop
+	stopped             chan struct{}      // closed when the cache goroutine exits
+	pulse               chan struct{}      // asks the cache goroutine to signal the heartbeat on behalf of BackendLocked
+	requestStream       chan<- *request    // sends requests to the work loop
+	enqueueMu           sync.RWMutex       // held for reading while GetAsync enqueues; see rejectQueued
+	opStream            chan op            // sends operations on the cache to the work loop
+	done                <-chan struct{}    // signals that the cache has shut down
+	cancel              context.CancelFunc // shuts the cache down on Close
+	abandoned           int                // entries still parsing, or abandoned, when the cache exited; read after stopped is closed
+	closeOnce           sync.Once
+	closeErr            error
+	log                 Logger
+	logSampler          *logSampler   // thins out per-request log messages; nil if every message is logged
+	latencyLogging      bool          // flags whether to log a latency breakdown for each request
+	logQueue            bool          // flags whether to log requests entering the queue and the time they wait
+	requestSeq          atomic.Uint64 // numbers requests for queue logging
+	retryTimeouts       bool          // flags whether to retry parsing templates that have previously timed out
+	sortFilepaths       bool          // flags whether each entry's Filepaths are sorted before use
+	strictDefinitions   bool          // flags whether to reject files that redefine the same template
+	readTimeout         time.Duration
+	slowParseThreshold  time.Duration                            // parses taking longer are logged and reported; zero if unset
+	open                func(path string) (io.ReadCloser, error) // opens template files for reading
+	templateName        func(path string) string                 // names the template parsed from each file
+	contextData         func(ctx context.Context) interface{}    // derives execution data from request contexts
+	defaultData         map[string]interface{}                   // execution data merged under the data for each named template
+	devMode             bool                                     // flags whether to reparse templates on every request
+	environment         string                                   // set by WithEnvironment; empty if unset
+	localizer           Localizer
+	renders             *renderCache                      // rendered output, confined to the cache goroutine
+	stats               map[string]*templateStats         // confined to the cache goroutine
+	index               sync.Map                          // mirrors the cache for TryGet; written only by the cache goroutine
+	loaders             sync.Map                          // the schematic's data loaders by name; written only by New and the cache goroutine
+	fileIndex           map[string]map[string]bool        // the keys of the entries composed from each file; confined to the cache goroutine
+	aliases             sync.Map                          // the targets of aliases registered via RegisterAlias; written only by the cache goroutine
+	generation          uint64                            // the current generation, incremented by Reload; confined to the cache goroutine
+	generationRefs      map[uint64]int                    // outstanding Generation handles by ID; confined to the cache goroutine
+	retired             map[uint64]map[string]*cacheEntry // the entries of superseded generations still referenced; confined to the cache goroutine
+	clock               Clock
+	eventHook           func(ev CacheEvent)
+	panicHandler        func(recovered interface{}) // called if the cache goroutine panics
+	transformParseErr   func(error) error           // applied to parse errors before they are cached
+	requestBuffer       int                         // capacity of the requestStream
+	backend             Backend
+	executeTimeout      time.Duration
+	streamingRender     bool                          // flags whether Render streams output rather than buffering it
+	allowEmptySchematic bool                          // flags whether the schematic may have no entries
+	allowConflicts      bool                          // flags whether to skip checking for conflicting options
+	noErrorCaching      bool                          // flags whether to reparse entries that failed to parse
+	maxDepth            int                           // the maximum number of templates in a chain; zero if unlimited
+	singlePass          bool                          // flags whether to parse uncached chains of templates in a single pass
+	compressRenders     bool                          // flags whether the render cache stores gzip-compressed output
+	injected            map[string]*template.Template // templates stored via Inject; confined to the cache goroutine
+	funcs               template.FuncMap              // functions available to every template when it is parsed
+	smokeTest           bool                          // flags whether New executes every template before starting the cache
+	smokeData           map[string]interface{}        // probe data for the smoke test, by template name
+	smokeSkipUnprobed   bool                          // flags whether the smoke test skips templates without probe data
+	partialGroups       map[string][]string           // files substituted for references to named groups in Filepaths
+	warmMu              sync.Mutex
+	warmErr             error // the aggregate error of the last warm-up to finish
 }
 
 // New configures a new *Doppel and returns it to the caller. It
 // should not be used concurrently with operations on the provided
 // schematic.
+//
+// New returns ErrEmptySchematic if schematic has no entries, unless
+// WithEmptySchematic is supplied, ErrNilTemplateSchematic if any of its
+// entries is nil, ErrDuplicateFilepath if an entry lists the same file
+// twice, and ErrUnknownPartialGroup if an entry references a partial group
+// not registered via WithPartialGroup. If an option is given an invalid
+// configuration, New returns an error matching ErrInvalidOption that names the
+// option, and if options conflict, an error matching ErrConflictingOptions that
+// lists the conflicts. If WithSmokeTest is supplied, New returns an error
+// matching ErrSmokeTestFailed if any template fails to parse or execute.
+//
+// If ctx is done before construction completes, New returns ctx's error,
+// wrapped to identify the phase of construction that was interrupted. The
+// returned *Doppel is nil whenever New returns an error.
 func New(ctx context.Context, schematic CacheSchematic, opts ...CacheOption) (*Doppel, error) {
+	if err := interrupted(ctx, "cycle check"); err != nil {
+		return nil, err
+	}
 	if cyclic, err := IsCyclic(schematic); cyclic {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
 
-	requestStream := make(chan *request)
-	// Place the requestStream under the control of the caller as if it had
-	// created it. This way, we have knowledge about when it is safe to close
-	// the requestStream even though this function is not the sender.
-	go func() {
-		<-ctx.Done()
-		close(requestStream)
-	}()
-
 	d := &Doppel{
-		schematic:     schematic.Clone(), // prevent race conditions as a result of external access
-		done:          ctx.Done(),
-		requestStream: requestStream,
+		schematic: schematic.Clone(), // prevent race conditions as a result of external access
+		done:      ctx.Done(),
+		opStream:  make(chan op),
+		backend:   defaultBackend,
 	}
+	d.stats = newStats(d.schematic)
+	d.generation = 1
+	d.generationRefs = make(map[uint64]int)
+	d.retired = make(map[uint64]map[string]*cacheEntry)
+	d.fileIndex = make(map[string]map[string]bool)
 
+	if err := interrupted(ctx, "option configuration"); err != nil {
+		return nil, err
+	}
 	for _, opt := range opts {
-		opt(d)
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.checkConflicts(); err != nil {
+		return nil, err
+	}
+
+	if err := interrupted(ctx, "schematic validation"); err != nil {
+		return nil, err
+	}
+	if d.normalizeName != nil {
+		if err := d.normalizeNames(); err != nil {
+			return nil, err
+		}
 	}
+	expanded, err := d.schematic.expandGroups(d.partialGroups)
+	if err != nil {
+		return nil, err
+	}
+	d.schematic = expanded
+	if d.sortFilepaths {
+		d.schematic.sortFilepaths()
+	}
+	if err := d.schematic.validate(d.allowEmptySchematic); err != nil {
+		return nil, err
+	}
+	d.storeLoaders(d.schematic)
 
 	if d.log == nil {
 		d.log = &defaultLog{}
 	}
+	for _, name := range d.schematic.unusedInternal() {
+		d.log.Printf(logInternalUnused, name)
+	}
+	if d.clock == nil {
+		d.clock = realClock{}
+	}
+	if d.templateName == nil {
+		d.templateName = filepath.Base
+	}
+	if d.open == nil {
+		d.open = openFile
+	}
 
+	if d.smokeTest {
+		if err := interrupted(ctx, "smoke test"); err != nil {
+			return nil, err
+		}
+		if err := d.runSmokeTest(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := interrupted(ctx, "cache startup"); err != nil {
+		return nil, err
+	}
+
+	// The requestStream is never closed: Gets may race with shutdown to send
+	// on it, and sending on a closed channel panics. Instead, the cache
+	// goroutine exits when ctx is done, rejecting any requests still queued.
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.done = ctx.Done()
+	requestStream := make(chan *request, d.requestBuffer)
+	d.requestStream = requestStream
 	d.startCache(requestStream)
 	return d, nil
 }
 
+// interrupted returns ctx's error, wrapped to identify the phase of New that
+// was interrupted, or nil if ctx is not done.
+func interrupted(ctx context.Context, phase string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("New interrupted before %s: %w", phase, err)
+	}
+	return nil
+}
+
 type request struct {
-	name         string         // the name of the template to fetch
-	resultStream chan<- *result // used by Get to receive results from the cache
-	start        time.Time      // calculate request runtime
+	name         string             // the name of the template to fetch
+	resultStream chan<- result      // used by Get to receive results from the cache
+	entryStream  chan<- *cacheEntry // if non-nil, receives the cache entry in place of a result
+	asyncStream  chan<- Result      // if non-nil, receives the result of GetAsync in place of resultStream
+	cancel       context.CancelFunc // releases ctx once an async result is sent
+	start        time.Time          // calculate request runtime
+	locale       string             // the locale variant to fetch, if any
+	localeFuncs  template.FuncMap
+	localeFiles  []string
+	id           uint64         // correlates queue log messages; zero unless queue logging is enabled
+	generation   uint64         // the generation requested via AtGeneration; zero for the current generation
+	timing       *requestTiming // nil unless latency logging is enabled
 
 	// While generally inadvisable to store contexts in structs, ctx functions
 	// solely as a messenger, informing downstream Get requests when the
@@ -75,6 +229,14 @@ type request struct {
 	ctx context.Context
 }
 
+// key returns the name under which the request's template is cached.
+func (r *request) key() string {
+	if r.locale == "" {
+		return r.name
+	}
+	return localizedKey(r.name, r.locale)
+}
+
 type result struct {
 	tmpl *template.Template
 	err  error
@@ -91,103 +253,565 @@ func (d *Doppel) startCache(requestStream <-chan *request) {
 	// Create heartbeat and request stream synchronously to ensure a caller can
 	// never receive nil channels.
 	d.heartbeat = make(chan struct{}, 1)
+	d.started = make(chan struct{})
+	d.stopped = make(chan struct{})
+	d.pulse = make(chan struct{}, 1)
 
 	go func() {
 		defer close(d.heartbeat)
 
 		cache := make(map[string]*cacheEntry)
-		for req := range requestStream {
-			d.log.Printf(logRequestReceived, req.name)
+		defer func() {
+			// Parses in progress abandon their work on shutdown, so they may
+			// already have failed with ErrDoppelShutdown.
+			for _, ce := range cache {
+				select {
+				case <-ce.ready:
+					if errors.Is(ce.err, ErrDoppelShutdown) {
+						d.abandoned++
+					}
+				default:
+					d.abandoned++
+				}
+			}
+			close(d.stopped)
+		}()
+		defer d.rejectQueued(requestStream)
+		defer func() {
+			// Shut the cache down so that requests fail with
+			// ErrDoppelShutdown rather than hang.
+			if r := recover(); r != nil {
+				d.log.Printf(logCachePanic, r)
+				if d.panicHandler != nil {
+					d.panicHandler(r)
+				}
+				d.cancel()
+			}
+		}()
+		close(d.started)
+		for {
 			select {
-			case d.heartbeat <- struct{}{}:
-				// Signals that cache is at the top of its work loop.
-			default:
+			case fn := <-d.opStream:
+				fn(cache)
+			case req := <-requestStream:
+				d.serve(cache, req)
+			case <-d.pulse:
+				d.beat()
+			case <-d.done:
+				return
 			}
+		}
+	}()
+}
 
-			select {
-			case <-req.ctx.Done():
-				d.log.Printf(logRequestInterrupted, req.name)
-				continue
-			default:
+// rejectQueued fails the requests still queued when the cache goroutine exits
+// with ErrDoppelShutdown, so that every channel returned by GetAsync receives a
+// result. It first waits for GetAsync calls that are enqueueing requests; later
+// calls see that the cache has shut down before enqueueing. Requests for base
+// templates are dropped, since getBase observes the shutdown itself.
+func (d *Doppel) rejectQueued(requestStream <-chan *request) {
+	d.enqueueMu.Lock()
+	defer d.enqueueMu.Unlock()
+	for {
+		select {
+		case req := <-requestStream:
+			if req.entryStream == nil {
+				d.reject(req, ErrDoppelShutdown)
 			}
+		default:
+			return
+		}
+	}
+}
 
-			entry := cache[req.name]
-			if entry == nil {
-				d.log.Printf(logParsingTemplate, req.name)
-				tmplSchematic := d.schematic[req.name]
-				if tmplSchematic != nil {
-					tmplSchematic = tmplSchematic.Clone()
-				}
+// serve handles a single request on behalf of the cache goroutine, creating a
+// cache entry and starting to parse it if necessary.
+func (d *Doppel) serve(cache map[string]*cacheEntry, req *request) {
+	key := req.key()
+	d.logSampled(logRequestReceived, key)
+	d.logDequeued(req)
+	if req.timing != nil {
+		req.timing.dequeued = d.clock.Now()
+	}
+	d.beat()
 
-				entry = &cacheEntry{
-					ready:     make(chan struct{}),
-					retry:     make(chan struct{}, 1),
-					schematic: tmplSchematic,
-				}
-				cache[req.name] = entry
-				go d.parse(entry, req)
+	select {
+	case <-req.ctx.Done():
+		d.log.Printf(logRequestInterrupted, key)
+		if req.asyncStream != nil {
+			d.logLatency(req, req.ctx.Err())
+			d.sendAsync(req, nil, req.ctx.Err())
+		}
+		return
+	default:
+	}
+
+	if ts := d.schematic[req.name]; ts != nil && ts.Internal && req.entryStream == nil {
+		d.log.Printf(logRequestInternal, key)
+		d.reject(req, fmt.Errorf("template %q: %w", req.name, ErrInternalTemplate))
+		return
+	}
+
+	if req.generation != 0 && req.generation != d.generation {
+		d.serveRetired(req)
+		return
+	}
+
+	stats := d.stats[req.name]
+	entry := cache[key]
+	if entry == nil || d.devMode || d.noErrorCaching && entry.failed() {
+		d.log.Printf(logParsingTemplate, key)
+		if stats != nil {
+			stats.misses++
+		}
+		d.emit(EventMiss, key)
+		entry = &cacheEntry{
+			name:  req.name,
+			ready: make(chan struct{}),
+			retry: make(chan struct{}, 1),
+			stats: stats,
+		}
+		if req.locale != "" {
+			// A locale variant is composed from the named template.
+			entry.schematic = &TemplateSchematic{BaseTmplName: req.name, Filepaths: req.localeFiles}
+			entry.funcs = req.localeFuncs
+			entry.depth = d.schematic.depth(req.name) + 1
+			entry.files, _ = d.schematic.filesFor(req.name)
+			for _, path := range req.localeFiles {
+				entry.files = append(entry.files, filepath.Clean(path))
 			}
-			go d.deliver(entry, req)
+		} else if tmpl := d.injected[req.name]; tmpl != nil {
+			entry.schematic = &TemplateSchematic{}
+			entry.depth = 1
+			entry.tmpl = tmpl
+			entry.parsedAt = d.clock.Now()
+			close(entry.ready)
+		} else if tmplSchematic := d.schematic[req.name]; tmplSchematic != nil {
+			entry.schematic = tmplSchematic.Clone()
+			entry.depth = d.schematic.depth(req.name)
+			entry.includes = d.schematic.includedFiles(req.name)
+			entry.bases = d.uncachedLineage(cache, req.name)
+			entry.files, _ = d.schematic.filesFor(req.name)
 		}
-	}()
+		d.storeEntry(cache, key, entry)
+		if entry.tmpl == nil { // injected templates are ready without parsing
+			go d.parse(entry, req)
+		}
+	} else {
+		if stats != nil {
+			atomic.AddUint64(&stats.hits, 1)
+		}
+		d.emit(EventHit, key)
+	}
+	d.dispatch(entry, req)
+}
+
+// dispatch answers req with entry on behalf of the cache goroutine.
+func (d *Doppel) dispatch(entry *cacheEntry, req *request) {
+	if req.entryStream != nil {
+		req.entryStream <- entry
+		return
+	}
+	select {
+	case <-entry.ready:
+		// Ready entries are answered inline, sparing a goroutine: collect
+		// doesn't block and results are sent on buffered channels.
+		d.deliver(entry, req)
+	default:
+		go d.deliver(entry, req)
+	}
+}
+
+// beat signals the heartbeat without blocking. It must be called from the cache
+// goroutine, which closes the heartbeat on exit.
+func (d *Doppel) beat() {
+	select {
+	case d.heartbeat <- struct{}{}:
+		// Signals that cache is at the top of its work loop.
+	default:
+	}
+}
+
+// canonical returns the name of the template identified by a name given by
+// the caller, normalized by the normalizer set via WithNameNormalizer, if any,
+// and resolved if it is an alias registered via RegisterAlias.
+func (d *Doppel) canonical(name string) string {
+	name = d.normalize(name)
+	if target, ok := d.aliases.Load(name); ok {
+		return target.(string)
+	}
+	return name
+}
+
+// normalize applies the normalizer set via WithNameNormalizer, if any, to name.
+func (d *Doppel) normalize(name string) string {
+	if d.normalizeName == nil {
+		return name
+	}
+	return d.normalizeName(name)
+}
+
+// normalizeNames puts the names of the templates in the Doppel's schematic and
+// its per-template configuration into canonical form.
+func (d *Doppel) normalizeNames() error {
+	cs, err := d.schematic.normalized(d.normalizeName)
+	if err != nil {
+		return err
+	}
+	d.schematic = cs
+	d.stats = newStats(cs)
+
+	if d.templateTimeouts != nil {
+		timeouts := make(map[string]time.Duration, len(d.templateTimeouts))
+		for name, timeout := range d.templateTimeouts {
+			timeouts[d.normalizeName(name)] = timeout
+		}
+		d.templateTimeouts = timeouts
+	}
+	if d.defaultData != nil {
+		defaults := make(map[string]interface{}, len(d.defaultData))
+		for name, data := range d.defaultData {
+			canonical := d.normalizeName(name)
+			if _, ok := defaults[canonical]; ok {
+				return invalidOption("WithDefaultData", "more than one template normalizes to %q", canonical)
+			}
+			defaults[canonical] = data
+		}
+		d.defaultData = defaults
+	}
+	if d.smokeData != nil {
+		probes := make(map[string]interface{}, len(d.smokeData))
+		for name, probe := range d.smokeData {
+			canonical := d.normalizeName(name)
+			if _, ok := probes[canonical]; ok {
+				return invalidOption("WithSmokeTest", "more than one template normalizes to %q", canonical)
+			}
+			probes[canonical] = probe
+		}
+		d.smokeData = probes
+	}
+	return nil
+}
+
+// storeEntry stores ce in cache under key and publishes it to the index read
+// by TryGet and the index of files read by InvalidateFile, replacing any entry
+// already stored under key. It must be called from the cache goroutine.
+func (d *Doppel) storeEntry(cache map[string]*cacheEntry, key string, ce *cacheEntry) {
+	d.unindexFiles(cache, key)
+	cache[key] = ce
+	d.index.Store(key, ce)
+	for _, path := range ce.files {
+		if d.fileIndex[path] == nil {
+			d.fileIndex[path] = make(map[string]bool)
+		}
+		d.fileIndex[path][key] = true
+	}
+}
+
+// deleteEntry removes key from cache and from the indexes maintained by
+// storeEntry. It must be called from the cache goroutine.
+func (d *Doppel) deleteEntry(cache map[string]*cacheEntry, key string) {
+	d.unindexFiles(cache, key)
+	delete(cache, key)
+	d.index.Delete(key)
+}
+
+// unindexFiles removes the entry stored under key, if any, from the index of
+// files.
+func (d *Doppel) unindexFiles(cache map[string]*cacheEntry, key string) {
+	ce := cache[key]
+	if ce == nil {
+		return
+	}
+	for _, path := range ce.files {
+		delete(d.fileIndex[path], key)
+		if len(d.fileIndex[path]) == 0 {
+			delete(d.fileIndex, path)
+		}
+	}
+}
+
+// reject answers req with err without consulting the cache.
+func (d *Doppel) reject(req *request, err error) {
+	res := result{err: err}
+	if req.asyncStream != nil {
+		tmpl, err := d.result(req, res)
+		d.sendAsync(req, tmpl, err)
+		return
+	}
+	req.resultStream <- res
+}
+
+// uncachedLineage returns the files of the base templates of the named
+// template, root first, if single-pass parsing is enabled and none of them is
+// cached. It returns nil if any base is cached, since cloning a cached base is
+// cheaper than parsing it again, or if the chain can't be parsed in a single
+// pass.
+func (d *Doppel) uncachedLineage(cache map[string]*cacheEntry, name string) []parseUnit {
+	if !d.singlePass {
+		return nil
+	}
+	names, ok := d.schematic.lineage(name)
+	if !ok {
+		return nil
+	}
+
+	bases := make([]parseUnit, len(names))
+	for i, base := range names {
+		// Dev mode reparses every base regardless of the cache.
+		if cache[base] != nil && !d.devMode {
+			return nil
+		}
+		bases[i] = parseUnit{
+			includes: d.schematic.includedFiles(base),
+			own:      append([]string(nil), d.schematic[base].Filepaths...),
+		}
+	}
+	return bases
+}
+
+// A Getter retrieves named templates. It is satisfied by *Doppel, and by the
+// package-level Get via GetterFunc, allowing code that only needs to fetch
+// templates to be tested against a fake such as doppeltest.Fake.
+type Getter interface {
+	Get(ctx context.Context, name string) (*template.Template, error)
+}
+
+// GetterFunc adapts an ordinary function, such as the package-level Get, to
+// the Getter interface.
+type GetterFunc func(ctx context.Context, name string) (*template.Template, error)
+
+// Get calls f(ctx, name).
+func (f GetterFunc) Get(ctx context.Context, name string) (*template.Template, error) {
+	return f(ctx, name)
 }
 
 // Get returns a named template from the cache. Get is thread-safe and
-// can be preempted via the supplied context.Context.
+// can be preempted via the supplied context.Context. Get returns
+// ErrEmptyName if name is empty.
+//
+// If the Doppel shuts down and ctx is done before the template is delivered,
+// Get returns ErrDoppelShutdown rather than ctx's error, regardless of which
+// happened first, so that callers can rely on context errors being worth a
+// retry.
 func (d *Doppel) Get(ctx context.Context, name string) (*template.Template, error) {
+	return d.get(ctx, &request{name: name})
+}
+
+// GetWithFuncs behaves like Get, but adds funcs to the returned copy of the
+// template, leaving the cached template untouched. This suits functions that
+// depend on request-scoped state, such as the current user.
+//
+// Templates may only call functions that are defined when they are parsed, so
+// funcs typically replaces placeholders registered via WithFuncs or a
+// Localizer. Functions in funcs take precedence over those of the same name.
+func (d *Doppel) GetWithFuncs(ctx context.Context, name string, funcs template.FuncMap) (*template.Template, error) {
+	tmpl, err := d.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Funcs(funcs), nil
+}
+
+// TryGet returns the named template if it is cached and ready, without
+// waiting for the cache goroutine or ever causing a parse. It returns
+// ErrNotReady if the template isn't cached or is still parsing, and the cached
+// error, as for Get, if parsing failed. Unlike Get, TryGet ignores dev mode,
+// returning any template already cached.
+func (d *Doppel) TryGet(name string) (*template.Template, error) {
+	name = d.canonical(name)
+	if name == "" {
+		return nil, ErrEmptyName
+	}
+	v, ok := d.index.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("template %q not cached: %w", name, ErrNotReady)
+	}
+	ce := v.(*cacheEntry)
+	if ce.internal() {
+		return nil, fmt.Errorf("template %q: %w", name, ErrInternalTemplate)
+	}
+	select {
+	case <-ce.ready:
+	default:
+		return nil, fmt.Errorf("template %q still parsing: %w", name, ErrNotReady)
+	}
+
+	req := &request{name: name, start: d.clock.Now()}
+	res, _ := d.collect(ce, req) // never blocks, since ce is ready
+	return d.result(req, res)
+}
+
+// get sends req to the cache and waits for the result. The caller is
+// responsible for identifying the template to fetch; get populates the
+// remaining fields.
+func (d *Doppel) get(ctx context.Context, req *request) (*template.Template, error) {
+	req.name = d.canonical(req.name)
+	if req.name == "" {
+		return nil, ErrEmptyName
+	}
+
 	select {
 	case <-d.done:
 		return nil, ErrDoppelShutdown
 	default:
 	}
 
-	// Buffer resultStream for cases where timeout expires concurrently with results being sent.
-	resultStream := make(chan *result, 1)
-	req := &request{
-		name:         name,
-		resultStream: resultStream,
-		start:        time.Now(),
+	req.start = d.clock.Now()
+	if d.latencyLogging {
+		req.timing = &requestTiming{}
 	}
 
-	if d.globalTimeout > 0 {
-		// WithTimeout retains the the parent context's timeout if
-		// d.globalTimeout occurs later.
+	if d.backend == BackendLocked && req.generation == 0 && ctx.Err() == nil {
+		if res, ok := d.lookupReady(req); ok {
+			return d.result(req, res)
+		}
+	}
+
+	// The cancellation of ctx when get returns ends recursive requests for
+	// base templates if the original request returns early (e.g. due to
+	// timeout). A context that can never be done needs no wrapper, since get
+	// then returns early only on shutdown, which recursive requests observe
+	// themselves.
+	switch timeout := d.timeoutFor(req.name); {
+	case timeout > 0:
+		// WithTimeout retains the the parent context's timeout if timeout
+		// occurs later.
+		var cancel context.CancelFunc
+		ctx, cancel = d.withTimeout(ctx, timeout)
+		defer cancel()
+	case ctx.Done() != nil:
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, d.globalTimeout)
+		ctx, cancel = context.WithCancel(ctx)
 		defer cancel()
 	}
-
-	// Wrap ctx to enforce cancellation of recursive Get requests if the
-	// original request returns early (e.g. due to timeout).
-	ctx, cancel := context.WithCancel(ctx)
 	req.ctx = ctx
-	defer cancel()
 
+	// Buffer resultStream for cases where timeout expires concurrently with
+	// results being sent. It is recycled only once its result is received.
+	resultStream := resultStreams.Get().(chan result)
+	req.resultStream = resultStream
+
+	d.logQueued(req)
 	select {
 	case <-d.done:
+		resultStreams.Put(resultStream)
 		return nil, ErrDoppelShutdown
 	case <-ctx.Done():
+		resultStreams.Put(resultStream)
+		if d.shutDown() {
+			return nil, ErrDoppelShutdown
+		}
 		return nil, RequestError{
-			errors.WithStack(ctx.Err()),
-			name,
-			time.Since(req.start),
+			ctx.Err(),
+			req.name,
+			d.since(req.start),
+			d.logLatency(req, ctx.Err()),
 		}
 	case d.requestStream <- req:
 	}
 
 	select {
 	case <-ctx.Done():
+		if d.shutDown() {
+			return nil, ErrDoppelShutdown
+		}
+		d.logLatency(req, ctx.Err())
 		return nil, ctx.Err()
+	case <-d.done:
+		// The cache may have served the request before shutting down.
+		select {
+		case res := <-resultStream:
+			resultStreams.Put(resultStream)
+			return d.result(req, res)
+		default:
+			return nil, ErrDoppelShutdown
+		}
 	case res := <-resultStream:
-		if res.err != nil {
-			return nil, RequestError{
-				errors.Wrap(res.err, "received error from cache"),
-				name,
-				time.Since(req.start),
+		resultStreams.Put(resultStream)
+		return d.result(req, res)
+	}
+}
+
+// resultStreams recycles the channels on which get receives results. The cache
+// sends on each exactly once, so a channel may be reused once its result has
+// been received, but never after get abandons it.
+var resultStreams = sync.Pool{
+	New: func() interface{} { return make(chan result, 1) },
+}
+
+// timeoutFor returns the timeout for requests for the named template: the
+// tighter of the global timeout and the template's own, or zero if neither is
+// set.
+func (d *Doppel) timeoutFor(name string) time.Duration {
+	timeout := d.globalTimeout
+	if t := d.templateTimeouts[name]; t > 0 && (timeout == 0 || t < timeout) {
+		timeout = t
+	}
+	return timeout
+}
+
+// result unpacks the result of req.
+func (d *Doppel) result(req *request, res result) (*template.Template, error) {
+	latency := d.logLatency(req, res.err)
+	if res.err != nil {
+		return nil, RequestError{
+			fmt.Errorf("received error from cache: %w", res.err),
+			req.name,
+			d.since(req.start),
+			latency,
+		}
+	}
+	return res.tmpl, nil
+}
+
+// Close shuts the cache down, as if the context passed to New had been
+// canceled, and waits for the cache goroutine to exit. Requests queued before
+// Close are served, but requests waiting for templates that are still being
+// parsed receive ErrDoppelShutdown. Close returns nil if no templates were
+// being parsed, and otherwise an error matching ErrRequestsAbandoned.
+//
+// Close satisfies io.Closer and is idempotent: later calls return the result
+// of the first, as does a Close after the context passed to New is canceled.
+func (d *Doppel) Close() error {
+	d.closeOnce.Do(func() {
+		d.cancel()
+		<-d.stopped
+		if d.abandoned > 0 {
+			d.closeErr = fmt.Errorf("%d templates still parsing: %w", d.abandoned, ErrRequestsAbandoned)
+		}
+	})
+	return d.closeErr
+}
+
+// Shutdown waits up to gracePeriod for templates that are being parsed to
+// finish, then shuts the Doppel down as for Close. Templates requested during
+// the grace period may still be parsed, but aren't waited for.
+func (d *Doppel) Shutdown(gracePeriod time.Duration) error {
+	var pending []chan struct{}
+	d.do(context.Background(), func(cache map[string]*cacheEntry) {
+		for _, ce := range cache {
+			select {
+			case <-ce.ready:
+			default:
+				pending = append(pending, ce.ready)
+			}
+		}
+	})
+
+	if len(pending) > 0 {
+		timer := d.clock.NewTimer(gracePeriod)
+		defer timer.Stop()
+	wait:
+		for _, ready := range pending {
+			select {
+			case <-ready:
+			case <-timer.C():
+				break wait
 			}
 		}
-		return res.tmpl, nil
 	}
+	return d.Close()
 }
 
 // Heartbeat returns the Doppel's heartbeat channel, which is guaranteed to be
@@ -196,38 +820,154 @@ func (d *Doppel) Heartbeat() <-chan struct{} {
 	return d.heartbeat
 }
 
-// IsCyclic reports whether a CacheSchematic contains a cycle. If
-// true, the accompanying error describes which TemplateSchematics
-// form part of the cycle.
+// Ready blocks until the cache is ready to serve requests, returning nil, or
+// until ctx is done. Ready returns ErrDoppelShutdown if the cache has shut
+// down, making it suitable for use in health checks.
+func (d *Doppel) Ready(ctx context.Context) error {
+	select {
+	case <-d.done:
+		return ErrDoppelShutdown
+	default:
+	}
+
+	select {
+	case <-d.started:
+		return nil
+	case <-d.done:
+		return ErrDoppelShutdown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutDown reports whether the Doppel has shut down, without blocking. Where
+// both shutdown and a request's cancellation are observed, shutdown takes
+// priority.
+func (d *Doppel) shutDown() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Healthy reports whether the cache goroutine responds within timeout. Rather
+// than requesting a template, it performs a no-op round trip to the cache, so
+// probes neither add entries to the cache nor count towards TemplateStats.
+// Healthy returns false immediately if the Doppel has shut down.
+func (d *Doppel) Healthy(timeout time.Duration) bool {
+	ctx, cancel := d.withTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.do(ctx, func(map[string]*cacheEntry) {}) == nil
+}
+
+// GlobalTimeout returns the timeout applied to every request, as set via
+// WithGlobalTimeout, or zero if there is none.
+//
+// The options a Doppel is configured with are fixed by New before the cache
+// starts and never modified, so they may be read from any goroutine without
+// synchronization. Its schematic is not: RestoreSchematic and Inject replace
+// it at runtime, so it is read only by the cache goroutine.
+func (d *Doppel) GlobalTimeout() time.Duration {
+	return d.globalTimeout
+}
+
+// RetryTimeoutsEnabled reports whether the Doppel was configured with
+// WithRetryTimeouts.
+func (d *Doppel) RetryTimeoutsEnabled() bool {
+	return d.retryTimeouts
+}
+
+// Environment returns the environment set via WithEnvironment, or an empty
+// string if there is none.
+func (d *Doppel) Environment() string {
+	return d.environment
+}
+
+// DevModeEnabled reports whether every request reparses its template, as
+// configured by WithDevMode or WithEnvironment.
+func (d *Doppel) DevModeEnabled() bool {
+	return d.devMode
+}
+
+// IsCyclic reports whether a CacheSchematic contains a cycle, whether through
+// base templates or includes. If true, the accompanying error describes which
+// TemplateSchematics form part of the cycle. The description is stable: the
+// same cycle is reported on every call, starting from the member whose name
+// sorts first.
 func IsCyclic(cs CacheSchematic) (bool, error) {
-	seen := make(map[string]bool)
-	var recStack []string // track TemplateSchematics already seen in the current traversal
-
-	var visit func(name string) error
-	visit = func(name string) error {
-		for _, seenName := range recStack {
-			if seenName == name {
-				msg := fmt.Sprintf("cycle through %s: %v", name, append(recStack, name))
-				return errors.New(msg)
-			}
+	// The graph is traversed iteratively, rather than recursively, so that
+	// pathologically deep schematics can't exhaust the stack.
+	const (
+		unvisited = iota
+		visiting  // on the current path
+		visited   // known not to lead to a cycle
+	)
+	type frame struct {
+		name  string
+		edges []string
+		next  int // index of the next edge to follow
+	}
+
+	state := make(map[string]int)
+	for _, start := range cs.names() {
+		if state[start] != unvisited {
+			continue
 		}
-		recStack = append(recStack, name)
 
-		var err error
-		if !seen[name] {
-			seen[name] = true
-			if tmplSchematic := cs[name]; tmplSchematic != nil {
-				err = visit(cs[name].BaseTmplName)
+		state[start] = visiting
+		path := []*frame{{name: start, edges: cs.edges(start)}}
+		for len(path) > 0 {
+			top := path[len(path)-1]
+			if top.next == len(top.edges) {
+				state[top.name] = visited
+				path = path[:len(path)-1]
+				continue
+			}
+
+			name := top.edges[top.next]
+			top.next++
+			switch state[name] {
+			case visiting:
+				names := make([]string, len(path))
+				for i, f := range path {
+					names[i] = f.name
+				}
+				cycle := canonicalCycle(names, name)
+				msg := fmt.Sprintf("cycle through %s: %v", cycle[0], append(cycle, cycle[0]))
+				return true, errors.New(msg)
+			case unvisited:
+				state[name] = visiting
+				path = append(path, &frame{name: name, edges: cs.edges(name)})
 			}
 		}
-		recStack = recStack[:len(recStack)-1]
-		return err
 	}
+	return false, nil
+}
+
+// canonicalCycle returns the cycle closed by an edge from the last name on
+// path to name, which is on path, rotated to begin with the member that sorts
+// first.
+func canonicalCycle(path []string, name string) []string {
+	start := len(path) - 1
+	for path[start] != name {
+		start--
+	}
+	members := path[start:]
 
-	for k := range cs {
-		if err := visit(k); err != nil {
-			return true, err
+	first := 0
+	for i, member := range members {
+		if member < members[first] {
+			first = i
 		}
 	}
-	return false, nil
+	cycle := make([]string, 0, len(members)+1) // room for the closing name
+	cycle = append(cycle, members[first:]...)
+	return append(cycle, members[:first]...)
+}
+
+// openFile opens the template file at path from the local filesystem.
+func openFile(path string) (io.ReadCloser, error) {
+	return os.Open(path)
 }
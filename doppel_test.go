@@ -6,11 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -25,10 +30,10 @@ var (
 )
 
 var schematic = CacheSchematic{
-	"base":      {"", []string{basepath}},
-	"commonNav": {"base", []string{navpath}},
-	"withBody1": {"commonNav", []string{body1Path}},
-	"withBody2": {"commonNav", []string{body2Path}},
+	"base":      {Filepaths: []string{basepath}},
+	"commonNav": {BaseTmplName: "base", Filepaths: []string{navpath}},
+	"withBody1": {BaseTmplName: "commonNav", Filepaths: []string{body1Path}},
+	"withBody2": {BaseTmplName: "commonNav", Filepaths: []string{body2Path}},
 }
 
 func TestNew(t *testing.T) {
@@ -66,14 +71,108 @@ func TestNew(t *testing.T) {
 				t.Error("schematic was not cloned")
 			}
 		})
+
+		t.Run("returns ErrEmptySchematic if schematic has no entries", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			for _, cs := range []CacheSchematic{nil, {}} {
+				if _, err := New(ctx, cs); !errors.Is(err, ErrEmptySchematic) {
+					t.Errorf("got error %v, want ErrEmptySchematic", err)
+				}
+			}
+		})
+
+		t.Run("accepts an empty schematic given WithEmptySchematic", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d, err := New(ctx, nil, WithEmptySchematic())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := d.RestoreSchematic(context.Background(), schematic); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+				t.Errorf("failed to serve template added at runtime: %v", err)
+			}
+		})
+
+		t.Run("returns ErrNilTemplateSchematic if an entry is nil", func(t *testing.T) {
+			testSchematic := schematic.Clone()
+			testSchematic["nilEntry"] = nil
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			_, err := New(ctx, testSchematic, WithEmptySchematic())
+			if !errors.Is(err, ErrNilTemplateSchematic) {
+				t.Fatalf("got error %v, want ErrNilTemplateSchematic", err)
+			}
+			if !strings.Contains(err.Error(), "nilEntry") {
+				t.Errorf("error %q does not identify the nil entry", err)
+			}
+		})
+
+		t.Run("returns ErrDuplicateFilepath if an entry lists a file twice", func(t *testing.T) {
+			testSchematic := schematic.Clone()
+			testSchematic["withBody1"].Filepaths = append(testSchematic["withBody1"].Filepaths, body1Path)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			_, err := New(ctx, testSchematic)
+			if !errors.Is(err, ErrDuplicateFilepath) {
+				t.Fatalf("got error %v, want ErrDuplicateFilepath", err)
+			}
+			if !strings.Contains(err.Error(), "withBody1") || !strings.Contains(err.Error(), body1Path) {
+				t.Errorf("error %q does not identify the entry and path", err)
+			}
+		})
+	})
+
+	t.Run("honors ctx during construction", func(t *testing.T) {
+		t.Run("already done", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			d, err := New(ctx, schematic)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got error %v, want context.Canceled", err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "cycle check") {
+				t.Errorf("error %q does not identify the interrupted phase", err)
+			}
+			if d != nil {
+				t.Errorf("got *Doppel %+v, want nil", d)
+			}
+		})
+
+		t.Run("done during construction", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cancelDuringOptions := OptionFunc(func(*Doppel) { cancel() })
+
+			d, err := New(ctx, schematic, cancelDuringOptions)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got error %v, want context.Canceled", err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "schematic validation") {
+				t.Errorf("error %q does not identify the interrupted phase", err)
+			}
+			if d != nil {
+				t.Errorf("got *Doppel %+v, want nil", d)
+			}
+		})
 	})
 
 	t.Run("calls functional options", func(t *testing.T) {
 		for _, optCount := range []int{0, 1, 10} {
 			var optsCalled int
-			opt := func(*Doppel) {
+			opt := OptionFunc(func(*Doppel) {
 				optsCalled++
-			}
+			})
 
 			optArgs := make([]CacheOption, optCount)
 			for i := range optArgs {
@@ -123,7 +222,7 @@ func TestNew(t *testing.T) {
 
 			req := &request{
 				name:         "base",
-				resultStream: make(chan<- *result, 1),
+				resultStream: make(chan<- result, 1),
 				ctx:          context.Background(),
 			}
 
@@ -241,6 +340,49 @@ func TestGet(t *testing.T) {
 		}
 	})
 
+	t.Run("returns ErrSchematicNotFound for nil entries", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// New rejects nil entries, so plant one as if the schematic had been
+		// modified in place.
+		err = d.do(context.Background(), func(map[string]*cacheEntry) {
+			d.schematic["withBody1"] = nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := d.Get(context.Background(), "withBody1"); !errors.Is(err, ErrSchematicNotFound) {
+			t.Errorf("got error %v, want ErrSchematicNotFound", err)
+		}
+	})
+
+	t.Run("returns ErrEmptyTemplateSchematic for templates with nothing to parse", func(t *testing.T) {
+		testSchematic := schematic.Clone()
+		testSchematic["empty"] = &TemplateSchematic{Filepaths: []string{}}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, testSchematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = d.Get(context.Background(), "empty")
+		if !errors.Is(err, ErrEmptyTemplateSchematic) {
+			t.Fatalf("got error %v, want ErrEmptyTemplateSchematic", err)
+		}
+		if !strings.Contains(err.Error(), `"empty"`) {
+			t.Errorf("error %q does not name the template", err)
+		}
+	})
+
 	t.Run("returns context.DeadlineExceeded if the request times out", func(t *testing.T) {
 		// Response time is non-deterministic, so excersise the full
 		// range of preemption points via random testing.
@@ -345,7 +487,7 @@ func TestGet(t *testing.T) {
 		defer cancel()
 
 		testSchematic := schematic.Clone()
-		testSchematic[target] = &TemplateSchematic{"", []string{"missing"}}
+		testSchematic[target] = &TemplateSchematic{Filepaths: []string{"missing"}}
 		log := &testLogger{out: &bytes.Buffer{}}
 		d, err := New(ctx, testSchematic, WithLogger(log))
 		if err != nil {
@@ -365,6 +507,439 @@ func TestGet(t *testing.T) {
 	})
 }
 
+func TestGetDoesNotLeakGoroutines(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+		t.Fatal(err)
+	}
+
+	baseline := runtime.NumGoroutine()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Time out at various points in the request cycle, abandoning
+			// results that the cache may still be trying to deliver.
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i*100)*time.Nanosecond)
+			defer cancel()
+			d.Get(ctx, "withBody1")
+		}(i)
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(1 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d goroutines after requests completed, want at most %d",
+				runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGetDeepChain(t *testing.T) {
+	const depth = 200
+	deep := linearChain(depth)
+	leaf := strconv.Itoa(depth - 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var rootOpened int32
+	release := make(chan struct{})
+	gatedOpen := OptionFunc(func(d *Doppel) {
+		d.open = func(path string) (io.ReadCloser, error) {
+			if path == basepath {
+				atomic.StoreInt32(&rootOpened, 1)
+				<-release
+			}
+			return os.Open(path)
+		}
+	})
+	d, err := New(ctx, deep, gatedOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseline := runtime.NumGoroutine()
+	type getResult struct {
+		tmpl *template.Template
+		err  error
+	}
+	resultStream := make(chan getResult, 1)
+	go func() {
+		tmpl, err := d.Get(context.Background(), leaf)
+		resultStream <- getResult{tmpl, err}
+	}()
+
+	// With the root's file read blocked, every level of the chain is waiting
+	// on its base.
+	waitFor(t, func() bool { return atomic.LoadInt32(&rootOpened) == 1 })
+	if growth := runtime.NumGoroutine() - baseline; growth > depth+10 {
+		t.Errorf("got %d additional goroutines for a chain %d deep, want at most %d", growth, depth, depth+10)
+	}
+	close(release)
+
+	res := <-resultStream
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+
+	ungated, err := New(ctx, deep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ungated.Get(context.Background(), leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotOut, wantOut bytes.Buffer
+	gotErr, wantErr := res.tmpl.Execute(&gotOut, nil), want.Execute(&wantOut, nil)
+	if fmt.Sprint(gotErr) != fmt.Sprint(wantErr) || gotOut.String() != wantOut.String() {
+		t.Errorf("got output %q (error %v), want %q (error %v)", gotOut.String(), gotErr, wantOut.String(), wantErr)
+	}
+}
+
+func TestGetWithFuncs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	userPath := filepath.Join(dir, "user.gohtml")
+	if err := ioutil.WriteFile(userPath, []byte(`{{define "body"}}{{user}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cs := schematic.Clone()
+	cs["withUser"] = &TemplateSchematic{BaseTmplName: "commonNav", Filepaths: []string{userPath}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d, err := New(ctx, cs, WithFuncs(template.FuncMap{"user": func() string { return "placeholder" }}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execute := func(t *testing.T, tmpl *template.Template) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	t.Run("concurrent calls don't contaminate each other", func(t *testing.T) {
+		const n = 20
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			user := fmt.Sprintf("user-%d", i)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				tmpl, err := d.GetWithFuncs(context.Background(), "withUser", template.FuncMap{
+					"user": func() string { return user },
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var buf bytes.Buffer
+				if err := tmpl.Execute(&buf, nil); err != nil {
+					t.Error(err)
+					return
+				}
+				if got := strings.Count(buf.String(), "user-"); got != 1 || !strings.Contains(buf.String(), user+"\n") {
+					t.Errorf("got output %q, want only %s", buf.String(), user)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("the cached template is untouched", func(t *testing.T) {
+		tmpl, err := d.Get(context.Background(), "withUser")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := execute(t, tmpl); !strings.Contains(got, "placeholder") {
+			t.Errorf("got output %q, want the placeholder function's output", got)
+		}
+	})
+
+	t.Run("returns Get's error", func(t *testing.T) {
+		_, err := d.GetWithFuncs(context.Background(), "missing", template.FuncMap{})
+		if !errors.Is(err, ErrSchematicNotFound) {
+			t.Errorf("got error %v, want ErrSchematicNotFound", err)
+		}
+	})
+}
+
+func TestTryGet(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d, err := New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("uncached templates aren't parsed", func(t *testing.T) {
+		if _, err := d.TryGet("withBody1"); !errors.Is(err, ErrNotReady) {
+			t.Errorf("got error %v, want ErrNotReady", err)
+		}
+		snap, err := d.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snap.Entries) != 0 {
+			t.Errorf("got %d cache entries, want 0", len(snap.Entries))
+		}
+	})
+
+	t.Run("returns a copy of ready templates", func(t *testing.T) {
+		want, err := d.Get(context.Background(), "withBody1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := d.TryGet("withBody1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == want {
+			t.Error("TryGet returned the same template as Get, want a copy")
+		}
+		if got.Lookup("body") == nil {
+			t.Error("returned template is missing \"body\"")
+		}
+	})
+
+	t.Run("returns cached errors", func(t *testing.T) {
+		if _, err := d.Get(context.Background(), "missing"); !errors.Is(err, ErrSchematicNotFound) {
+			t.Fatalf("got error %v, want ErrSchematicNotFound", err)
+		}
+		if _, err := d.TryGet("missing"); !errors.Is(err, ErrSchematicNotFound) {
+			t.Errorf("got error %v, want ErrSchematicNotFound", err)
+		}
+	})
+
+	t.Run("entries still parsing aren't ready", func(t *testing.T) {
+		err := d.do(context.Background(), func(cache map[string]*cacheEntry) {
+			d.storeEntry(cache, "parsing", &cacheEntry{ready: make(chan struct{})})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.TryGet("parsing"); !errors.Is(err, ErrNotReady) {
+			t.Errorf("got error %v, want ErrNotReady", err)
+		}
+	})
+
+	t.Run("evicted templates aren't ready", func(t *testing.T) {
+		if err := d.Invalidate(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.TryGet("withBody1"); !errors.Is(err, ErrNotReady) {
+			t.Errorf("got error %v, want ErrNotReady", err)
+		}
+		if _, err := d.TryGet("commonNav"); err != nil {
+			t.Errorf("got error %v for an unaffected template, want nil", err)
+		}
+	})
+}
+
+func TestGetShutdownTakesPriority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d, err := New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	for range d.Heartbeat() {
+	}
+
+	reqCtx, reqCancel := context.WithCancel(context.Background())
+	reqCancel()
+	for i := 0; i < 100; i++ {
+		if _, err := d.Get(reqCtx, "base"); err != ErrDoppelShutdown {
+			t.Fatalf("Get: iteration %d: want ErrDoppelShutdown, got: %v", i, err)
+		}
+		if res := <-d.GetAsync(reqCtx, "base"); res.Err != ErrDoppelShutdown {
+			t.Fatalf("GetAsync: iteration %d: want ErrDoppelShutdown, got: %v", i, res.Err)
+		}
+	}
+}
+
+func TestGetShutdownMidParse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	defer close(release)
+	hungOpen := OptionFunc(func(d *Doppel) {
+		d.open = func(string) (io.ReadCloser, error) {
+			return &slowReader{release}, nil
+		}
+	})
+	rec := &eventRecorder{}
+	d, err := New(ctx, schematic, hungOpen, WithEventHook(rec.record))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errStream := make(chan error)
+	go func() {
+		_, err := d.Get(context.Background(), "withBody1")
+		errStream <- err
+	}()
+	waitFor(t, func() bool { return len(d.InFlight()) == 3 })
+	cancel()
+
+	select {
+	case err := <-errStream:
+		if err != ErrDoppelShutdown {
+			t.Errorf("want ErrDoppelShutdown, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get did not return within 1s of shutdown")
+	}
+
+	// The parse of the root template, whose read is hung, is abandoned.
+	waitFor(t, func() bool { return rec.count(EventParseError, "base") == 1 })
+}
+
+func TestGetAlias(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testSchematic := schematic.Clone()
+	testSchematic["homepage"] = &TemplateSchematic{BaseTmplName: "withBody1"}
+	rec := &eventRecorder{}
+	d, err := New(ctx, testSchematic, WithEventHook(rec.record))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	render := func(name string) string {
+		t.Helper()
+		tmpl, err := d.Get(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	if got, want := render("homepage"), render("withBody1"); got != want {
+		t.Errorf("alias rendered %q, want %q", got, want)
+	}
+
+	t.Run("is evicted with its base", func(t *testing.T) {
+		if err := d.Invalidate(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+		if n := rec.count(EventEvict, "homepage"); n != 1 {
+			t.Errorf("got %d evictions of alias, want 1", n)
+		}
+	})
+
+	t.Run("participates in cycle detection", func(t *testing.T) {
+		cyclic := testSchematic.Clone()
+		cyclic["base"].BaseTmplName = "homepage"
+		if ok, _ := IsCyclic(cyclic); !ok {
+			t.Error("IsCyclic reported false for cycle through alias")
+		}
+	})
+}
+
+func TestInternalTemplates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testSchematic := schematic.Clone()
+	testSchematic["commonNav"].Internal = true
+	testSchematic["orphan"] = &TemplateSchematic{Filepaths: []string{basepath}, Internal: true}
+	logger := &testLogger{out: &bytes.Buffer{}}
+	d, err := New(ctx, testSchematic, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := fmt.Sprintf(logInternalUnused, "orphan"); !strings.Contains(logger.String(), want) {
+		t.Errorf("log doesn't warn of unused internal template: %q", logger.String())
+	}
+	if unwanted := fmt.Sprintf(logInternalUnused, "commonNav"); strings.Contains(logger.String(), unwanted) {
+		t.Errorf("log warns of internal template in use: %q", logger.String())
+	}
+
+	assertRejected := func(t *testing.T) {
+		t.Helper()
+		if _, err := d.Get(context.Background(), "commonNav"); !errors.Is(err, ErrInternalTemplate) {
+			t.Errorf("Get: want ErrInternalTemplate, got: %v", err)
+		}
+		if res := <-d.GetAsync(context.Background(), "commonNav"); !errors.Is(res.Err, ErrInternalTemplate) {
+			t.Errorf("GetAsync: want ErrInternalTemplate, got: %v", res.Err)
+		}
+	}
+
+	t.Run("rejects direct requests", assertRejected)
+
+	t.Run("may be used as a base", func(t *testing.T) {
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("rejects direct requests once cached", func(t *testing.T) {
+		assertRejected(t)
+		if _, err := d.TryGet("commonNav"); !errors.Is(err, ErrInternalTemplate) {
+			t.Errorf("TryGet: want ErrInternalTemplate, got: %v", err)
+		}
+	})
+
+	t.Run("is distinct from other errors", func(t *testing.T) {
+		_, err := d.Get(context.Background(), "commonNav")
+		for _, other := range []error{ErrSchematicNotFound, ErrNotReady, ErrDoppelShutdown} {
+			if errors.Is(err, other) {
+				t.Errorf("error %v matches %v", err, other)
+			}
+		}
+	})
+}
+
+func TestGetEmptyName(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := &testLogger{out: &bytes.Buffer{}}
+	d, err := New(ctx, schematic, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Get(context.Background(), ""); !errors.Is(err, ErrEmptyName) {
+		t.Errorf("Get: got error %v, want ErrEmptyName", err)
+	}
+	if _, err := d.TryGet(""); !errors.Is(err, ErrEmptyName) {
+		t.Errorf("TryGet: got error %v, want ErrEmptyName", err)
+	}
+	if res := <-d.GetAsync(context.Background(), ""); !errors.Is(res.Err, ErrEmptyName) {
+		t.Errorf("GetAsync: got error %v, want ErrEmptyName", res.Err)
+	}
+	if out := logger.String(); out != "" {
+		t.Errorf("the cache received requests for an empty name:\n%s", out)
+	}
+}
+
 func TestIsCyclic(t *testing.T) {
 	testCycle := func(start, end string, t *testing.T) {
 		cyclicSchematic := schematic.Clone()
@@ -393,6 +968,34 @@ func TestIsCyclic(t *testing.T) {
 		})
 	}
 
+	t.Run("handles pathologically deep schematics", func(t *testing.T) {
+		deep := linearChain(100000)
+		if cycle, err := IsCyclic(deep); cycle || err != nil {
+			t.Errorf("got (%t, %v), want (false, nil)", cycle, err)
+		}
+
+		deep["0"].BaseTmplName = "99999"
+		if cycle, _ := IsCyclic(deep); !cycle {
+			t.Error("failed to detect cycle")
+		}
+	})
+
+	t.Run("reports the same cycle on every call", func(t *testing.T) {
+		cs := CacheSchematic{
+			"entry": {BaseTmplName: "c"},
+			"a":     {BaseTmplName: "b"},
+			"b":     {BaseTmplName: "c"},
+			"c":     {BaseTmplName: "a"},
+			"z":     {BaseTmplName: "z"},
+		}
+		const want = "cycle through a: [a b c a]"
+		for i := 0; i < 20; i++ {
+			if _, err := IsCyclic(cs.Clone()); err == nil || err.Error() != want {
+				t.Fatalf("call %d: got error %v, want %q", i, err, want)
+			}
+		}
+	})
+
 	t.Run("returns false for acylic schematics", func(t *testing.T) {
 		cycle, err := IsCyclic(schematic)
 		if cycle {
@@ -404,6 +1007,144 @@ func TestIsCyclic(t *testing.T) {
 	})
 }
 
+// isCyclicReference is a straightforward recursive cycle check against which
+// IsCyclic is compared.
+func isCyclicReference(cs CacheSchematic) bool {
+	var onStack []string
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		for _, n := range onStack {
+			if n == name {
+				return true
+			}
+		}
+		onStack = append(onStack, name)
+		defer func() { onStack = onStack[:len(onStack)-1] }()
+		for _, next := range cs.edges(name) {
+			if visit(next) {
+				return true
+			}
+		}
+		return false
+	}
+	for name := range cs {
+		if visit(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestIsCyclicRandomGraphs(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		n := 1 + rng.Intn(8)
+		cs := make(CacheSchematic, n)
+		for j := 0; j < n; j++ {
+			ts := &TemplateSchematic{}
+			if rng.Intn(3) > 0 {
+				ts.BaseTmplName = strconv.Itoa(rng.Intn(n))
+			}
+			if rng.Intn(4) == 0 {
+				ts.Includes = []string{strconv.Itoa(rng.Intn(n))}
+			}
+			cs[strconv.Itoa(j)] = ts
+		}
+
+		got, err := IsCyclic(cs)
+		if want := isCyclicReference(cs); got != want {
+			t.Fatalf("graph %d: got %t, want %t: %+v", i, got, want, cs)
+		}
+		if !got {
+			continue
+		}
+		_, again := IsCyclic(cs.Clone())
+		if err.Error() != again.Error() {
+			t.Fatalf("graph %d: got %q, then %q", i, err, again)
+		}
+	}
+}
+
+func BenchmarkIsCyclic(b *testing.B) {
+	chain := linearChain(50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if cyclic, err := IsCyclic(chain); cyclic {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	t.Run("shuts down cleanly", func(t *testing.T) {
+		d, err := New(context.Background(), schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+
+		var closer io.Closer = d
+		if err := closer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Get(context.Background(), "withBody1"); !errors.Is(err, ErrDoppelShutdown) {
+			t.Errorf("got error %v, want ErrDoppelShutdown", err)
+		}
+		if err := d.Close(); err != nil {
+			t.Errorf("second Close: got error %v, want nil", err)
+		}
+	})
+
+	t.Run("reports abandoned requests", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		slowOpen := OptionFunc(func(d *Doppel) {
+			d.open = func(string) (io.ReadCloser, error) {
+				return &slowReader{release}, nil
+			}
+		})
+		d, err := New(context.Background(), schematic, slowOpen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errStream := make(chan error)
+		go func() {
+			_, err := d.Get(context.Background(), "base")
+			errStream <- err
+		}()
+		waitFor(t, func() bool {
+			snap, err := d.Snapshot(context.Background())
+			return err == nil && len(snap.Entries) == 1
+		})
+
+		err = d.Close()
+		if !errors.Is(err, ErrRequestsAbandoned) {
+			t.Errorf("got error %v, want ErrRequestsAbandoned", err)
+		}
+		if err := <-errStream; !errors.Is(err, ErrDoppelShutdown) {
+			t.Errorf("got Get error %v, want ErrDoppelShutdown", err)
+		}
+		if again := d.Close(); again != err {
+			t.Errorf("second Close: got error %v, want %v", again, err)
+		}
+	})
+
+	t.Run("succeeds after the context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if err := d.Close(); err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+	})
+}
+
 func TestHeartbeat(t *testing.T) {
 	t.Run("returns a channel that receives a signal on each new request cycle", func(t *testing.T) {
 		const timeout = 1
@@ -439,6 +1180,110 @@ func TestHeartbeat(t *testing.T) {
 	})
 }
 
+func TestHealthy(t *testing.T) {
+	t.Run("reports true while the cache is running without affecting it", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !d.Healthy(time.Second) {
+			t.Error("got false, want true")
+		}
+
+		stats, err := d.Stats(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Entries != 0 {
+			t.Errorf("got %d cache entries after probe, want 0", stats.Entries)
+		}
+		tmplStats, err := d.TemplateStats(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, ts := range tmplStats {
+			if ts != (TemplateStats{}) {
+				t.Errorf("%s: got %+v after probe, want zero TemplateStats", name, ts)
+			}
+		}
+	})
+
+	t.Run("reports false if the cache has shut down", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		for range d.Heartbeat() {
+		}
+
+		if d.Healthy(time.Hour) {
+			t.Error("got true, want false")
+		}
+	})
+
+	t.Run("reports false if the cache doesn't respond within timeout", func(t *testing.T) {
+		// The cache goroutine is never started.
+		clk := newFakeClock()
+		d := &Doppel{done: make(chan struct{}), opStream: make(chan op), clock: clk}
+
+		healthyStream := make(chan bool)
+		go func() { healthyStream <- d.Healthy(time.Second) }()
+
+		waitFor(t, func() bool { return clk.Timers() > 0 })
+		clk.Advance(time.Second)
+		if <-healthyStream {
+			t.Error("got true, want false")
+		}
+	})
+}
+
+func TestReady(t *testing.T) {
+	t.Run("returns nil once the cache is running", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		readyCtx, readyCancel := context.WithTimeout(context.Background(), time.Second)
+		defer readyCancel()
+		if err := d.Ready(readyCtx); err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+	})
+
+	t.Run("returns ErrDoppelShutdown if the cache has shut down", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+
+		if err := d.Ready(context.Background()); err != ErrDoppelShutdown {
+			t.Errorf("got error %v, want ErrDoppelShutdown", err)
+		}
+	})
+
+	t.Run("returns the context's error if it is done first", func(t *testing.T) {
+		// The cache goroutine is never started.
+		d := &Doppel{started: make(chan struct{}), done: make(chan struct{})}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := d.Ready(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v, want context.Canceled", err)
+		}
+	})
+}
+
 // Run StressTest with the -race flag to ensure no race conditions
 // develop under load.
 func Test_StressTest(t *testing.T) {
@@ -493,3 +1338,133 @@ func Test_StressTest(t *testing.T) {
 		}
 	}
 }
+
+// BenchmarkGetCached measures the cost of a Get served from a warm cache, where
+// the work loop's own overhead is most visible.
+func BenchmarkGetCached(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, schematic)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	for _, buffer := range []int{0, 64} {
+		b.Run(fmt.Sprintf("buffer=%d", buffer), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d, err := New(ctx, schematic, WithRequestBuffer(buffer))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkGetWarmParallel(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, schematic)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkGetUncached(b *testing.B) {
+	for _, bc := range []struct {
+		desc string
+		opts []CacheOption
+	}{
+		{"incremental", nil},
+		{"single pass", []CacheOption{WithSinglePassParsing()}},
+	} {
+		b.Run(bc.desc, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d, err := New(ctx, schematic, bc.opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			for i := 0; i < b.N; i++ {
+				if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+					b.Fatal(err)
+				}
+				if err := d.Invalidate(context.Background(), "base"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetTimeout(b *testing.B) {
+	// WithVerboseErrors no longer has any effect, so both modes should
+	// allocate the same on the timeout path.
+	for _, verbose := range []bool{true, false} {
+		b.Run(fmt.Sprintf("verbose=%t", verbose), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d, err := New(ctx, schematic, WithVerboseErrors(verbose))
+			if err != nil {
+				b.Fatal(err)
+			}
+			// Requests are never received, so that every Get times out.
+			d.requestStream = make(chan *request)
+			reqCtx, reqCancel := context.WithCancel(context.Background())
+			reqCancel()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := d.Get(reqCtx, "withBody1"); !errors.Is(err, context.Canceled) {
+					b.Fatalf("got error %v, want context.Canceled", err)
+				}
+			}
+		})
+	}
+}
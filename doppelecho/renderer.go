@@ -0,0 +1,37 @@
+// Package doppelecho adapts a *doppel.Doppel to Echo's Renderer interface. It
+// is a separate module so that doppel itself does not depend on Echo.
+package doppelecho
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/angusgmorrison/doppel"
+	"github.com/labstack/echo/v4"
+)
+
+// Renderer implements echo.Renderer by retrieving templates from a
+// *doppel.Doppel.
+type Renderer struct {
+	d *doppel.Doppel
+}
+
+// New returns a Renderer backed by d.
+func New(d *doppel.Doppel) *Renderer {
+	return &Renderer{d: d}
+}
+
+// Render retrieves the named template using the request's context and
+// executes it into w. If the template's schematic does not exist, Render
+// returns an *echo.HTTPError with status 404.
+func (r *Renderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	tmpl, err := r.d.Get(c.Request().Context(), name)
+	if err != nil {
+		if errors.Is(err, doppel.ErrSchematicNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound).SetInternal(err)
+		}
+		return err
+	}
+	return tmpl.Execute(w, data)
+}
@@ -0,0 +1,54 @@
+package doppelecho
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/angusgmorrison/doppel"
+	"github.com/labstack/echo/v4"
+)
+
+var schematic = doppel.CacheSchematic{
+	"base":      {Filepaths: []string{"../test_fixtures/base.gohtml"}},
+	"commonNav": {BaseTmplName: "base", Filepaths: []string{"../test_fixtures/nav.gohtml"}},
+	"withBody1": {BaseTmplName: "commonNav", Filepaths: []string{"../test_fixtures/body_1.gohtml"}},
+}
+
+func TestRender(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := doppel.New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Renderer = New(d)
+
+	t.Run("renders the named template", func(t *testing.T) {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+		var buf bytes.Buffer
+		if err := e.Renderer.Render(&buf, "withBody1", nil, c); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(buf.Bytes(), []byte("first of two possible body sections")) {
+			t.Errorf("rendered output is missing body: %s", buf.String())
+		}
+	})
+
+	t.Run("returns a 404 HTTPError for missing templates", func(t *testing.T) {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+		err := e.Renderer.Render(&bytes.Buffer{}, "missing", nil, c)
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusNotFound {
+			t.Errorf("want *echo.HTTPError with status 404, got: %v", err)
+		}
+	})
+}
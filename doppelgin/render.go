@@ -0,0 +1,91 @@
+// Package doppelgin adapts a *doppel.Doppel to Gin's HTML rendering
+// interfaces. It is a separate module so that doppel itself does not depend
+// on Gin.
+package doppelgin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/angusgmorrison/doppel"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+var htmlContentType = []string{"text/html; charset=utf-8"}
+
+// HTMLRender implements render.HTMLRender by retrieving templates from a
+// *doppel.Doppel. Assign it to gin.Engine.HTMLRender to use it with
+// gin.Context.HTML.
+//
+// Gin does not pass the request to HTMLRender, so templates retrieved via
+// gin.Context.HTML are not bound by the request's context. Use HTML to render
+// with the request's context instead.
+type HTMLRender struct {
+	d *doppel.Doppel
+}
+
+// New returns an HTMLRender backed by d.
+func New(d *doppel.Doppel) *HTMLRender {
+	return &HTMLRender{d: d}
+}
+
+// Instance returns a render.Render for the named template.
+func (hr *HTMLRender) Instance(name string, data interface{}) render.Render {
+	return &Render{
+		ctx:  context.Background(),
+		d:    hr.d,
+		Name: name,
+		Data: data,
+	}
+}
+
+// Render is a render.Render that retrieves and executes a template from a
+// *doppel.Doppel.
+type Render struct {
+	ctx  context.Context
+	d    *doppel.Doppel
+	Name string
+	Data interface{}
+}
+
+// Render retrieves the template and executes it into w. If the template's
+// schematic does not exist, the status is set to 404 before the error is
+// returned.
+func (r *Render) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+
+	tmpl, err := r.d.Get(r.ctx, r.Name)
+	if err != nil {
+		if errors.Is(err, doppel.ErrSchematicNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return err
+	}
+	return tmpl.Execute(w, r.Data)
+}
+
+// WriteContentType sets the response's Content-Type to HTML.
+func (r *Render) WriteContentType(w http.ResponseWriter) {
+	header := w.Header()
+	if val := header["Content-Type"]; len(val) == 0 {
+		header["Content-Type"] = htmlContentType
+	}
+}
+
+// HTML renders the named template with the given status code using the
+// *doppel.Doppel that backs c's engine, bounded by the request's context. If
+// the template's schematic does not exist, the request is aborted with 404.
+func HTML(c *gin.Context, d *doppel.Doppel, code int, name string, data interface{}) {
+	tmpl, err := d.Get(c.Request.Context(), name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, doppel.ErrSchematicNotFound) {
+			status = http.StatusNotFound
+		}
+		c.AbortWithError(status, err)
+		return
+	}
+	c.Render(code, render.HTML{Template: tmpl, Data: data})
+}
@@ -0,0 +1,88 @@
+package doppelgin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/angusgmorrison/doppel"
+	"github.com/gin-gonic/gin"
+)
+
+var schematic = doppel.CacheSchematic{
+	"base":      {Filepaths: []string{"../test_fixtures/base.gohtml"}},
+	"commonNav": {BaseTmplName: "base", Filepaths: []string{"../test_fixtures/nav.gohtml"}},
+	"withBody1": {BaseTmplName: "commonNav", Filepaths: []string{"../test_fixtures/body_1.gohtml"}},
+}
+
+func newDoppel(t *testing.T) (*doppel.Doppel, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d, err := doppel.New(ctx, schematic)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	return d, cancel
+}
+
+func TestHTMLRender(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	d, cancel := newDoppel(t)
+	defer cancel()
+
+	t.Run("renders the named template", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		if err := New(d).Instance("withBody1", nil).Render(rec); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(rec.Body.String(), "first of two possible body sections") {
+			t.Errorf("rendered output is missing body: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("sets status 404 for missing templates", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		if err := New(d).Instance("missing", nil).Render(rec); err == nil {
+			t.Error("failed to return an error for missing template")
+		}
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("got status %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestHTML(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	d, cancel := newDoppel(t)
+	defer cancel()
+
+	t.Run("renders the named template", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+		HTML(c, d, http.StatusOK, "withBody1", nil)
+		if rec.Code != http.StatusOK {
+			t.Errorf("got status %d, want %d", rec.Code, http.StatusOK)
+		}
+		if !strings.Contains(rec.Body.String(), "first of two possible body sections") {
+			t.Errorf("rendered output is missing body: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("aborts with 404 for missing templates", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+		HTML(c, d, http.StatusOK, "missing", nil)
+		if !c.IsAborted() {
+			t.Error("request was not aborted")
+		}
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("got status %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+}
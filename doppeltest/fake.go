@@ -0,0 +1,141 @@
+// Package doppeltest provides utilities for testing code that retrieves
+// templates from a doppel cache.
+package doppeltest
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"sync"
+	"time"
+
+	"github.com/angusgmorrison/doppel"
+)
+
+// A Call records a single request made to a Fake.
+type Call struct {
+	Ctx  context.Context
+	Name string
+}
+
+// A Fake is an in-memory doppel.Getter for use in tests. Like a Doppel, it
+// returns a clone of each stored template, so callers may add to or execute
+// the result without affecting subsequent requests. Requests for names it has
+// not been seeded with fail with an error matching doppel.ErrSchematicNotFound.
+//
+// A Fake is safe for concurrent use. Its zero value is ready to use.
+type Fake struct {
+	mu        sync.Mutex
+	templates map[string]*template.Template
+	errs      map[string]error
+	delays    map[string]time.Duration
+	calls     []Call
+}
+
+var _ doppel.Getter = (*Fake)(nil)
+
+// NewFake returns a Fake seeded with templates.
+func NewFake(templates map[string]*template.Template) *Fake {
+	f := &Fake{}
+	for name, tmpl := range templates {
+		f.SetTemplate(name, tmpl)
+	}
+	return f
+}
+
+// SetTemplate causes requests for name to return a clone of tmpl, replacing
+// any template or error previously set for name. Since executed templates
+// can't be cloned, SetTemplate panics if tmpl has already been executed.
+func (f *Fake) SetTemplate(name string, tmpl *template.Template) {
+	clone := template.Must(tmpl.Clone()) // isolate the stored template from the caller
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.templates == nil {
+		f.templates = make(map[string]*template.Template)
+	}
+	f.templates[name] = clone
+	delete(f.errs, name)
+}
+
+// SetError causes requests for name to fail with err, replacing any template
+// or error previously set for name.
+func (f *Fake) SetError(name string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.errs == nil {
+		f.errs = make(map[string]error)
+	}
+	f.errs[name] = err
+	delete(f.templates, name)
+}
+
+// SetDelay causes requests for name to block for delay before returning,
+// unless the request's context is done first. A delay of zero removes any
+// existing delay.
+func (f *Fake) SetDelay(name string, delay time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if delay <= 0 {
+		delete(f.delays, name)
+		return
+	}
+	if f.delays == nil {
+		f.delays = make(map[string]time.Duration)
+	}
+	f.delays[name] = delay
+}
+
+// Get records the request and returns a clone of the template set for name,
+// or the error set for name, wrapped such that errors.Is reports a match. Like
+// a Doppel, it returns doppel.ErrEmptyName if name is empty.
+func (f *Fake) Get(ctx context.Context, name string) (*template.Template, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{ctx, name})
+	tmpl, err, delay := f.templates[name], f.errs[name], f.delays[name]
+	f.mu.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	switch {
+	case name == "":
+		return nil, doppel.ErrEmptyName
+	case err != nil:
+		return nil, fmt.Errorf("received error from cache: %w", err)
+	case tmpl == nil:
+		return nil, fmt.Errorf("template %q: %w", name, doppel.ErrSchematicNotFound)
+	}
+
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// Calls returns the requests made to the Fake, in the order they were made.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Names returns the names requested from the Fake, in the order they were
+// requested.
+func (f *Fake) Names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, len(f.calls))
+	for i, c := range f.calls {
+		names[i] = c.Name
+	}
+	return names
+}
@@ -0,0 +1,127 @@
+package doppeltest
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/angusgmorrison/doppel"
+)
+
+func TestFake(t *testing.T) {
+	page := template.Must(template.New("page").Parse(`{{ template "body" . }}`))
+
+	t.Run("returns a clone of the seeded template", func(t *testing.T) {
+		f := NewFake(map[string]*template.Template{"page": page})
+
+		tmpl, err := f.Get(context.Background(), "page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tmpl == page {
+			t.Fatal("returned the seeded template rather than a clone")
+		}
+		template.Must(tmpl.New("body").Parse("modified"))
+
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, nil); err != nil {
+			t.Fatal(err)
+		}
+		again, err := f.Get(context.Background(), "page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.Lookup("body") != nil {
+			t.Error("modifications to a returned template affected the next request")
+		}
+	})
+
+	t.Run("returns seeded errors", func(t *testing.T) {
+		errTest := errors.New("test error")
+		f := &Fake{}
+		f.SetError("page", errTest)
+
+		if _, err := f.Get(context.Background(), "page"); !errors.Is(err, errTest) {
+			t.Errorf("got error %v, want %v", err, errTest)
+		}
+	})
+
+	t.Run("returns ErrSchematicNotFound for unknown names", func(t *testing.T) {
+		f := &Fake{}
+		if _, err := f.Get(context.Background(), "missing"); !errors.Is(err, doppel.ErrSchematicNotFound) {
+			t.Errorf("got error %v, want ErrSchematicNotFound", err)
+		}
+	})
+
+	t.Run("returns ErrEmptyName for empty names", func(t *testing.T) {
+		f := &Fake{}
+		if _, err := f.Get(context.Background(), ""); !errors.Is(err, doppel.ErrEmptyName) {
+			t.Errorf("got error %v, want ErrEmptyName", err)
+		}
+	})
+
+	t.Run("records requests", func(t *testing.T) {
+		f := NewFake(map[string]*template.Template{"page": page})
+		type key struct{}
+		ctx := context.WithValue(context.Background(), key{}, "value")
+
+		f.Get(ctx, "page")
+		f.Get(context.Background(), "missing")
+
+		calls := f.Calls()
+		if len(calls) != 2 {
+			t.Fatalf("got %d calls, want 2", len(calls))
+		}
+		if calls[0].Ctx.Value(key{}) != "value" {
+			t.Error("failed to record the request context")
+		}
+		if names := f.Names(); names[0] != "page" || names[1] != "missing" {
+			t.Errorf("got names %v, want [page missing]", names)
+		}
+	})
+
+	t.Run("delayed requests can be preempted", func(t *testing.T) {
+		f := NewFake(map[string]*template.Template{"page": page})
+		f.SetDelay("page", time.Minute)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := f.Get(ctx, "page"); err != context.DeadlineExceeded {
+			t.Errorf("got error %v, want context.DeadlineExceeded", err)
+		}
+
+		f.SetDelay("page", 0)
+		if _, err := f.Get(context.Background(), "page"); err != nil {
+			t.Errorf("request was delayed after delay was removed: %v", err)
+		}
+	})
+
+	t.Run("is safe for concurrent use", func(t *testing.T) {
+		f := &Fake{}
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				f.SetTemplate("page", page)
+			}()
+			go func() {
+				defer wg.Done()
+				f.Get(context.Background(), "page")
+			}()
+		}
+		wg.Wait()
+		if got := len(f.Calls()); got != 20 {
+			t.Errorf("got %d calls, want 20", got)
+		}
+	})
+}
+
+func TestGetterFunc(t *testing.T) {
+	var _ doppel.Getter = (*doppel.Doppel)(nil)
+	var _ doppel.Getter = doppel.GetterFunc(doppel.Get)
+}
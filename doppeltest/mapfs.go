@@ -0,0 +1,55 @@
+package doppeltest
+
+import (
+	"context"
+	"testing/fstest"
+
+	"github.com/angusgmorrison/doppel"
+)
+
+// An Edge makes Base the base template of Template in a MapSchematic.
+type Edge struct {
+	Template string
+	Base     string
+}
+
+// A MapSchematic is a doppel.CacheSchematic whose template files are held in
+// memory, allowing schematics to be tested without touching disk.
+type MapSchematic struct {
+	Schematic doppel.CacheSchematic
+	FS        fstest.MapFS
+}
+
+// NewMapSchematic returns a MapSchematic with one template for each entry in
+// files, parsed from a single file whose path is the template's name and whose
+// contents are the entry's source. graph sets the base template of each
+// template that has one. Since templates are named after the base of their
+// paths, names should be distinct after their final slash.
+func NewMapSchematic(files map[string]string, graph ...Edge) *MapSchematic {
+	ms := &MapSchematic{
+		Schematic: make(doppel.CacheSchematic, len(files)),
+		FS:        make(fstest.MapFS, len(files)),
+	}
+	for name, src := range files {
+		ms.Schematic[name] = &doppel.TemplateSchematic{Filepaths: []string{name}}
+		ms.FS[name] = &fstest.MapFile{Data: []byte(src)}
+	}
+	for _, e := range graph {
+		if ts := ms.Schematic[e.Template]; ts != nil {
+			ts.BaseTmplName = e.Base
+		} else {
+			ms.Schematic[e.Template] = &doppel.TemplateSchematic{BaseTmplName: e.Base}
+		}
+	}
+	return ms
+}
+
+// Option returns a CacheOption that reads the MapSchematic's files.
+func (ms *MapSchematic) Option() doppel.CacheOption {
+	return doppel.WithFS(ms.FS)
+}
+
+// New returns a *doppel.Doppel for the MapSchematic, configured with opts.
+func (ms *MapSchematic) New(ctx context.Context, opts ...doppel.CacheOption) (*doppel.Doppel, error) {
+	return doppel.New(ctx, ms.Schematic, append([]doppel.CacheOption{ms.Option()}, opts...)...)
+}
@@ -0,0 +1,39 @@
+package doppeltest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestMapSchematic(t *testing.T) {
+	ms := NewMapSchematic(
+		map[string]string{
+			"layout":      `[{{template "body"}}]`,
+			"pages/home":  `{{define "body"}}home{{end}}`,
+			"pages/about": `{{define "body"}}about{{end}}`,
+		},
+		Edge{Template: "pages/home", Base: "layout"},
+		Edge{Template: "pages/about", Base: "layout"},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d, err := ms.New(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"pages/home":  "[home]",
+		"pages/about": "[about]",
+	} {
+		var buf bytes.Buffer
+		if err := d.Execute(context.Background(), &buf, name, nil); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Errorf("%s: got %q, want %q", name, buf.String(), want)
+		}
+	}
+}
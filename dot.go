@@ -0,0 +1,31 @@
+package doppel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// WriteDOT writes the CacheSchematic to w as a graph in the DOT language, for
+// rendering with Graphviz. Each template is a node with an edge to its base
+// template and a dashed edge to each template it includes. Templates are
+// written in sorted order, so the output is deterministic.
+func (cs CacheSchematic) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph schematic {")
+	for _, name := range cs.names() {
+		fmt.Fprintf(bw, "\t%q;\n", name)
+		ts := cs[name]
+		if ts == nil {
+			continue
+		}
+		if ts.BaseTmplName != "" {
+			fmt.Fprintf(bw, "\t%q -> %q;\n", name, ts.BaseTmplName)
+		}
+		for _, inc := range ts.Includes {
+			fmt.Fprintf(bw, "\t%q -> %q [style=dashed];\n", name, inc)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -0,0 +1,30 @@
+package doppel
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	cs := CacheSchematic{
+		"base":  {Filepaths: []string{"base.gohtml"}},
+		"flash": {Filepaths: []string{"flash.gohtml"}},
+		"page":  {BaseTmplName: "base", Filepaths: []string{"page.gohtml"}, Includes: []string{"flash"}},
+	}
+	var buf bytes.Buffer
+	if err := cs.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `digraph schematic {
+	"base";
+	"flash";
+	"page";
+	"page" -> "base";
+	"page" -> "flash" [style=dashed];
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
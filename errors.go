@@ -1,9 +1,8 @@
 package doppel
 
 import (
+	"errors"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 // RequestError provides additional context to errors that occur during the
@@ -12,6 +11,7 @@ type RequestError struct {
 	error
 	Target          string // the template the request attempted to retrieve
 	RequestDuration time.Duration
+	Latency         *Latency // the breakdown of RequestDuration; nil unless WithLatencyLogging is supplied
 }
 
 // Is returns true if the Error's underlying error matches err.
@@ -19,6 +19,11 @@ func (re RequestError) Is(err error) bool {
 	return re.Error() == err.Error()
 }
 
+// Unwrap returns the underlying error.
+func (re RequestError) Unwrap() error {
+	return re.error
+}
+
 // ErrDoppelShutdown is used in response to requests to a Doppel
 // with an closed cache.
 var ErrDoppelShutdown = errors.New("can't send request to stopped cache")
@@ -27,10 +32,108 @@ var ErrDoppelShutdown = errors.New("can't send request to stopped cache")
 // in the Doppel's CacheSchematic.
 var ErrSchematicNotFound = errors.New("requested *TemplateSchematic not found")
 
-// ErrNotInitialized is used when a Get request is made to the
-// global cache before Initialize is called.
-var ErrNotInitialized = errors.New("Get was called before initializing the global cache")
+// ErrNotReady is used when TryGet is called for a template that isn't cached,
+// or is still being parsed.
+var ErrNotReady = errors.New("template not ready")
+
+// ErrNotInitialized is used when Get, Close or Shutdown is called on the global
+// cache before Initialize is called.
+var ErrNotInitialized = errors.New("global cache is not initialized")
 
 // ErrAlreadyInitialized is used when the user attempts to
 // call Initialize when the global cache is already running.
 var ErrAlreadyInitialized = errors.New("the global cache is already running")
+
+// ErrDuplicateDefinition is used when strict definitions are enabled and more
+// than one of a TemplateSchematic's files defines the same template name.
+var ErrDuplicateDefinition = errors.New("template defined in multiple files")
+
+// ErrExecuteTimeout is used when executing a template takes longer than the
+// timeout set via WithExecuteTimeout.
+var ErrExecuteTimeout = errors.New("template execution timed out")
+
+// ErrEmptySchematic is used when New or Initialize is called with a nil or
+// empty CacheSchematic without WithEmptySchematic.
+var ErrEmptySchematic = errors.New("schematic has no entries")
+
+// ErrEmptyTemplateSchematic is used when a template is requested whose
+// TemplateSchematic has no base template, files or includes. The accompanying
+// error message identifies the template.
+var ErrEmptyTemplateSchematic = errors.New("template schematic has nothing to parse")
+
+// ErrNilTemplateSchematic is used when a CacheSchematic maps a name to a nil
+// *TemplateSchematic. The accompanying error message identifies the name.
+var ErrNilTemplateSchematic = errors.New("schematic entry is nil")
+
+// ErrInvalidOption is used when a CacheOption is given an invalid
+// configuration. The accompanying error message identifies the option.
+var ErrInvalidOption = errors.New("invalid cache option")
+
+// ErrConflictingOptions is used when New is given CacheOptions that interact
+// badly. The accompanying error message lists each conflict.
+var ErrConflictingOptions = errors.New("conflicting cache options")
+
+// ErrDuplicateFilepath is used when a TemplateSchematic's Filepaths contains
+// the same path more than once. The accompanying error message identifies the
+// schematic and the path.
+var ErrDuplicateFilepath = errors.New("file path listed more than once")
+
+// ErrMaxDepthExceeded is used when a template's chain of base templates is
+// longer than the limit set via WithMaxDepth.
+var ErrMaxDepthExceeded = errors.New("template chain exceeds maximum depth")
+
+// ErrInvalidTemplates is used when CheckSchematic finds templates that fail
+// to parse. The accompanying error message lists each failure.
+var ErrInvalidTemplates = errors.New("templates failed to parse")
+
+// ErrUnknownPartialGroup is used when a TemplateSchematic's Filepaths
+// references a partial group that wasn't registered via WithPartialGroup. The
+// accompanying error message identifies the schematic and the group.
+var ErrUnknownPartialGroup = errors.New("unknown partial group")
+
+// ErrNilTemplate is used when a nil *template.Template is passed to Inject.
+var ErrNilTemplate = errors.New("template is nil")
+
+// ErrSmokeTestFailed is used when templates fail to parse or execute during
+// the smoke test enabled by WithSmokeTest. The accompanying error message
+// lists each failure.
+var ErrSmokeTestFailed = errors.New("smoke test failed")
+
+// ErrSchematicSyntax is used when ParseSchematicText encounters a malformed
+// line. The accompanying error message identifies the line.
+var ErrSchematicSyntax = errors.New("malformed schematic text")
+
+// ErrWarmFailed is used when templates fail to parse during a warm-up started
+// by Warm, or the warm-up is canceled. The accompanying error message lists
+// each failure.
+var ErrWarmFailed = errors.New("warm-up failed")
+
+// ErrRequestsAbandoned is returned by Close when templates were still being
+// parsed as the cache shut down, so that requests waiting for them were
+// abandoned.
+var ErrRequestsAbandoned = errors.New("requests abandoned on close")
+
+// ErrEmptyName is used when a template is requested with an empty name, which
+// usually indicates an uninitialized variable.
+var ErrEmptyName = errors.New("template name is empty")
+
+// ErrInternalTemplate is used when a template marked Internal in its
+// TemplateSchematic is requested directly, rather than as the base of another.
+var ErrInternalTemplate = errors.New("template is internal")
+
+// ErrInvalidSchematic is used by ValidateSchematic when a CacheSchematic has
+// one or more problems. The accompanying error message lists each problem.
+var ErrInvalidSchematic = errors.New("invalid schematic")
+
+// ErrGenerationUnavailable is used when a template is requested from a
+// generation that has been dropped, or in which it wasn't cached.
+var ErrGenerationUnavailable = errors.New("template generation unavailable")
+
+// ErrIncompatibleData is returned by Execute and related methods when data
+// passed for a template can't be merged with the default data registered for
+// it via WithDefaultData.
+var ErrIncompatibleData = errors.New("execution data incompatible with default data")
+
+// ErrAliasConflict is returned by RegisterAlias when the alias is the name of
+// a TemplateSchematic, which the alias would shadow.
+var ErrAliasConflict = errors.New("alias conflicts with a schematic entry")
@@ -0,0 +1,60 @@
+package doppel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/angusgmorrison/doppel"
+)
+
+// TestSentinelErrors checks that sentinel errors can be matched via errors.Is
+// from outside the package, through every layer of wrapping applied to them.
+func TestSentinelErrors(t *testing.T) {
+	cs := doppel.CacheSchematic{
+		"base": {Filepaths: []string{"test_fixtures/base.gohtml"}},
+	}
+
+	t.Run("ErrSchematicNotFound", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := doppel.New(ctx, cs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = d.Get(context.Background(), "missing")
+		if !errors.Is(err, doppel.ErrSchematicNotFound) {
+			t.Errorf("got error %v, want ErrSchematicNotFound", err)
+		}
+		var reqErr doppel.RequestError
+		if !errors.As(err, &reqErr) || reqErr.Target != "missing" {
+			t.Errorf("got error %v, want a RequestError targeting %q", err, "missing")
+		}
+	})
+
+	t.Run("ErrDoppelShutdown", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		d, err := doppel.New(ctx, cs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+
+		if err := d.Ready(context.Background()); !errors.Is(err, doppel.ErrDoppelShutdown) {
+			t.Errorf("got error %v, want ErrDoppelShutdown", err)
+		}
+	})
+
+	t.Run("ErrAlreadyInitialized", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if err := doppel.Initialize(ctx, cs); err != nil && !errors.Is(err, doppel.ErrAlreadyInitialized) {
+			t.Fatal(err)
+		}
+
+		if err := doppel.Initialize(ctx, cs); !errors.Is(err, doppel.ErrAlreadyInitialized) {
+			t.Errorf("got error %v, want ErrAlreadyInitialized", err)
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package doppel
+
+// EventType identifies the kind of a CacheEvent.
+type EventType string
+
+// The events reported to the hook provided by WithEventHook.
+const (
+	EventHit        EventType = "hit"         // a request was served by an existing cache entry
+	EventMiss       EventType = "miss"        // a request created a new cache entry
+	EventParseError EventType = "parse_error" // parsing failed and the error was cached
+	EventRetry      EventType = "retry"       // parsing was interrupted and will be retried
+	EventEvict      EventType = "evict"       // a cache entry was evicted
+	EventSlowParse  EventType = "slow_parse"  // a parse exceeded the threshold set by WithSlowParseThreshold
+)
+
+// A CacheEvent describes a notable occurrence in the cache.
+type CacheEvent struct {
+	Type EventType
+	Name string // the cache key, which includes the locale for locale variants
+}
+
+// emit reports an event to the Doppel's event hook, if any.
+func (d *Doppel) emit(typ EventType, name string) {
+	if d.eventHook != nil {
+		d.eventHook(CacheEvent{typ, name})
+	}
+}
@@ -0,0 +1,82 @@
+package doppel
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// eventRecorder records CacheEvents for later inspection.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []CacheEvent
+}
+
+func (er *eventRecorder) record(ev CacheEvent) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	er.events = append(er.events, ev)
+}
+
+// count returns the number of recorded events matching typ and name.
+func (er *eventRecorder) count(typ EventType, name string) int {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	var n int
+	for _, ev := range er.events {
+		if ev.Type == typ && ev.Name == name {
+			n++
+		}
+	}
+	return n
+}
+
+func TestWithEventHook(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testSchematic := schematic.Clone()
+	testSchematic["error"] = &TemplateSchematic{Filepaths: []string{"missing"}}
+	rec := &eventRecorder{}
+	d, err := New(ctx, testSchematic, WithEventHook(rec.record))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"withBody1", "withBody1", "error"} {
+		d.Get(context.Background(), name)
+	}
+	if err := d.Invalidate(context.Background(), "withBody1"); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		typ  EventType
+		name string
+		want int
+	}{
+		{EventMiss, "withBody1", 1},
+		{EventHit, "withBody1", 1},
+		{EventMiss, "base", 1},
+		{EventParseError, "error", 1},
+		{EventParseError, "withBody1", 0},
+		{EventEvict, "withBody1", 1},
+		{EventEvict, "base", 0},
+	}
+	for _, tc := range testCases {
+		if got := rec.count(tc.typ, tc.name); got != tc.want {
+			t.Errorf("got %d %s events for %q, want %d", got, tc.typ, tc.name, tc.want)
+		}
+	}
+
+	t.Run("classifies canceled and timed out parses for retry", func(t *testing.T) {
+		ce := &cacheEntry{err: context.Canceled, retry: make(chan struct{}, 1), ready: make(chan struct{})}
+		if !ce.retryable(false) {
+			t.Error("canceled parse is not retryable")
+		}
+		ce.err = context.DeadlineExceeded
+		if ce.retryable(false) || !ce.retryable(true) {
+			t.Error("timed out parse is retryable only with retryTimeouts")
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package doppel_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/angusgmorrison/doppel"
+)
+
+func ExampleMiddleware() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := doppel.New(ctx, doppel.CacheSchematic{
+		"base":      {Filepaths: []string{"test_fixtures/base.gohtml"}},
+		"commonNav": {BaseTmplName: "base", Filepaths: []string{"test_fixtures/nav.gohtml"}},
+		"withBody1": {BaseTmplName: "commonNav", Filepaths: []string{"test_fixtures/body_1.gohtml"}},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, ok := doppel.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "no template cache", http.StatusInternalServerError)
+			return
+		}
+
+		tmpl, err := d.Get(r.Context(), "withBody1")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tmpl.Execute(w, nil)
+	})
+
+	server := httptest.NewServer(doppel.Middleware(d)(handler))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+
+	fmt.Println(res.StatusCode)
+	fmt.Println(strings.Contains(string(body), "first of two possible body sections"))
+	// Output:
+	// 200
+	// true
+}
@@ -0,0 +1,227 @@
+package doppel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+)
+
+// Execute retrieves the named template and executes it with data, writing the
+// output to w. If a context data function was provided via
+// WithContextDataFunc, its result is combined with data as described there.
+// If the template's TemplateSchematic has a Loader, the data it returns is
+// combined beneath the result; a Loader error is returned as a RequestError
+// without executing the template. Any default data registered for the template
+// via WithDefaultData is merged beneath the result.
+//
+// If an execute timeout was set via WithExecuteTimeout, output is buffered and
+// only written to w if execution completes in time.
+func (d *Doppel) Execute(ctx context.Context, w io.Writer, name string, data interface{}) error {
+	name = d.canonical(name)
+	tmpl, err := d.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	data, err = d.executionData(ctx, name, data)
+	if err != nil {
+		return err
+	}
+	if d.executeTimeout <= 0 {
+		return tmpl.Execute(w, data)
+	}
+	return d.executeWithTimeout(ctx, w, tmpl, data)
+}
+
+// executeWithTimeout executes tmpl into a buffer in a separate goroutine,
+// returning ErrExecuteTimeout if it does not complete within the Doppel's
+// execute timeout. Execution can't be interrupted, so a goroutine that times
+// out is abandoned and runs until execution finishes.
+func (d *Doppel) executeWithTimeout(ctx context.Context, w io.Writer, tmpl *template.Template, data interface{}) error {
+	type execution struct {
+		out []byte
+		err error
+	}
+	// Buffer executionStream so that an abandoned goroutine can always exit.
+	executionStream := make(chan execution, 1)
+	go func() {
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, data)
+		executionStream <- execution{buf.Bytes(), err}
+	}()
+
+	timer := d.clock.NewTimer(d.executeTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return ErrExecuteTimeout
+	case ex := <-executionStream:
+		if ex.err != nil {
+			return ex.err
+		}
+		_, err := w.Write(ex.out)
+		return err
+	}
+}
+
+// executionData combines explicit data with data derived from ctx by the
+// Doppel's context data function, if any, and with data fetched by the named
+// template's Loader, if any, and merges the result over the template's default
+// data.
+func (d *Doppel) executionData(ctx context.Context, name string, data interface{}) (interface{}, error) {
+	data, err := d.loadedData(ctx, name, d.contextualData(ctx, data))
+	if err != nil {
+		return nil, err
+	}
+
+	defaults, ok := d.defaultData[name]
+	if !ok {
+		return data, nil
+	}
+	if data == nil {
+		return defaults, nil
+	}
+	perRequest, ok := data.(map[string]interface{})
+	defaultMap, defaultIsMap := defaults.(map[string]interface{})
+	if !ok || !defaultIsMap {
+		return nil, fmt.Errorf("template %q: can't merge %T with default data of type %T: %w",
+			name, data, defaults, ErrIncompatibleData)
+	}
+	return mergeData(defaultMap, perRequest), nil
+}
+
+// contextualData combines explicit data with data derived from ctx by the
+// Doppel's context data function, if any. Explicit data takes precedence: maps
+// are merged with explicit keys winning, and any other non-nil value replaces
+// the context data entirely.
+func (d *Doppel) contextualData(ctx context.Context, data interface{}) interface{} {
+	if d.contextData == nil {
+		return data
+	}
+	return overlayData(d.contextData(ctx), data)
+}
+
+// loadedData calls the named template's Loader, if any, and combines its result
+// beneath data as for contextualData. A Loader error is returned as a
+// RequestError.
+func (d *Doppel) loadedData(ctx context.Context, name string, data interface{}) (interface{}, error) {
+	loader, ok := d.loaders.Load(name)
+	if !ok {
+		return data, nil
+	}
+
+	start := d.clock.Now()
+	loaded, err := loader.(func(context.Context) (interface{}, error))(ctx)
+	if err != nil {
+		return nil, RequestError{fmt.Errorf("loading data: %w", err), name, d.since(start), nil}
+	}
+	return overlayData(loaded, data), nil
+}
+
+// storeLoaders replaces the loaders available to Execute and friends with those
+// of cs.
+func (d *Doppel) storeLoaders(cs CacheSchematic) {
+	for name, ts := range cs {
+		if ts != nil && ts.Loader != nil {
+			d.loaders.Store(name, ts.Loader)
+		}
+	}
+	d.loaders.Range(func(name, _ interface{}) bool {
+		if ts := cs[name.(string)]; ts == nil || ts.Loader == nil {
+			d.loaders.Delete(name)
+		}
+		return true
+	})
+}
+
+// overlayData returns over combined with under: maps are merged with the keys
+// of over winning, and any other non-nil over replaces under entirely.
+func overlayData(under, over interface{}) interface{} {
+	if over == nil {
+		return under
+	}
+	overMap, ok := over.(map[string]interface{})
+	if !ok {
+		return over
+	}
+	underMap, ok := under.(map[string]interface{})
+	if !ok {
+		return over
+	}
+	return mergeData(underMap, overMap)
+}
+
+// mergeData returns a new map containing the entries of under and over, with
+// those of over taking precedence.
+func mergeData(under, over map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(under)+len(over))
+	for k, v := range under {
+		merged[k] = v
+	}
+	for k, v := range over {
+		merged[k] = v
+	}
+	return merged
+}
+
+// ExecuteStream retrieves the named template and executes it with data,
+// combined with any context and default data as for Execute, streaming output
+// to w as it is produced rather than buffering it. If w is an http.Flusher, it
+// is flushed after every flushEvery bytes written; a flushEvery of zero or less
+// disables intermediate flushing.
+//
+// Execution stops at the next write after ctx is done, returning ctx's error.
+// Because output is streamed, anything written before an error occurs has
+// already been sent: an HTTP handler can't change the response's headers or
+// status once streaming has begun.
+func (d *Doppel) ExecuteStream(ctx context.Context, w io.Writer, name string, data interface{}, flushEvery int) error {
+	name = d.canonical(name)
+	tmpl, err := d.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	data, err = d.executionData(ctx, name, data)
+	if err != nil {
+		return err
+	}
+
+	sw := &streamWriter{ctx: ctx, w: w, flushEvery: flushEvery}
+	sw.flusher, _ = w.(http.Flusher)
+	if err := tmpl.Execute(sw, data); err != nil {
+		return err
+	}
+	if sw.flusher != nil && sw.unflushed > 0 {
+		sw.flusher.Flush()
+	}
+	return nil
+}
+
+// streamWriter wraps an io.Writer, refusing writes once ctx is done and
+// periodically flushing the underlying writer if it supports it.
+type streamWriter struct {
+	ctx        context.Context
+	w          io.Writer
+	flusher    http.Flusher
+	flushEvery int
+	unflushed  int // bytes written since the last flush
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if err := sw.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := sw.w.Write(p)
+	sw.unflushed += n
+	if sw.flusher != nil && sw.flushEvery > 0 && sw.unflushed >= sw.flushEvery {
+		sw.flusher.Flush()
+		sw.unflushed = 0
+	}
+	return n, err
+}
@@ -0,0 +1,366 @@
+package doppel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// flushRecorder counts flushes and optionally calls onWrite after each write.
+type flushRecorder struct {
+	bytes.Buffer
+	flushes int
+	onWrite func()
+}
+
+func (fr *flushRecorder) Write(p []byte) (int, error) {
+	n, err := fr.Buffer.Write(p)
+	if fr.onWrite != nil {
+		fr.onWrite()
+	}
+	return n, err
+}
+
+func (fr *flushRecorder) Flush() {
+	fr.flushes++
+}
+
+func TestExecuteStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("streams the executed template, flushing periodically", func(t *testing.T) {
+		want, err := d.Get(context.Background(), "withBody1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wantBuf bytes.Buffer
+		if err := want.Execute(&wantBuf, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		const flushEvery = 64
+		rec := &flushRecorder{}
+		if err := d.ExecuteStream(context.Background(), rec, "withBody1", nil, flushEvery); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := rec.String(); got != wantBuf.String() {
+			t.Errorf("got output %q, want %q", got, wantBuf.String())
+		}
+		// Output exceeds flushEvery several times over, so expect at least one
+		// intermediate flush in addition to the final one.
+		if rec.flushes < 2 {
+			t.Errorf("got %d flushes, want at least 2", rec.flushes)
+		}
+	})
+
+	t.Run("stops writing when the context is canceled mid-stream", func(t *testing.T) {
+		reqCtx, reqCancel := context.WithCancel(context.Background())
+		defer reqCancel()
+
+		var writes int
+		rec := &flushRecorder{}
+		rec.onWrite = func() {
+			writes++
+			reqCancel()
+		}
+
+		err := d.ExecuteStream(reqCtx, rec, "withBody1", nil, 1)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("want context.Canceled, got: %v", err)
+		}
+		if writes != 1 {
+			t.Errorf("got %d writes after cancellation, want 1", writes)
+		}
+	})
+}
+
+type localeKey struct{}
+
+func TestExecute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "greeting.gohtml")
+	if err := ioutil.WriteFile(path, []byte(`{{.locale}} {{.title}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	contextData := func(ctx context.Context) interface{} {
+		return map[string]interface{}{
+			"locale": ctx.Value(localeKey{}),
+			"title":  "from context",
+		}
+	}
+	d, err := New(ctx, CacheSchematic{"greeting": {Filepaths: []string{path}}}, WithContextDataFunc(contextData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc string
+		data interface{}
+		want string
+	}{
+		{"uses context data when data is nil", nil, "en-GB from context"},
+		{"merges maps with explicit keys winning", map[string]interface{}{"title": "explicit"}, "en-GB explicit"},
+		{"uses other explicit data as is", map[string]string{"title": "typed"}, " typed"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			reqCtx := context.WithValue(context.Background(), localeKey{}, "en-GB")
+			var buf bytes.Buffer
+			if err := d.Execute(reqCtx, &buf, "greeting", tc.data); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// blockingData blocks template execution when its Value method is called
+// until release is closed.
+type blockingData struct {
+	release chan struct{}
+}
+
+func (bd blockingData) Value() string {
+	<-bd.release
+	return "released"
+}
+
+func TestWithDefaultData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "footer.gohtml")
+	if err := ioutil.WriteFile(path, []byte(`{{.site}} {{.version}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	defaults := map[string]interface{}{"site": "doppel", "version": "v1"}
+	d, err := New(ctx,
+		CacheSchematic{
+			"footer": {Filepaths: []string{path}},
+			"other":  {Filepaths: []string{path}},
+		},
+		WithDefaultData("footer", defaults))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults["site"] = "changed" // must not be observed
+
+	testCases := []struct {
+		desc string
+		name string
+		data interface{}
+		want string
+	}{
+		{"uses default data when data is nil", "footer", nil, "doppel v1"},
+		{"merges maps with per-request keys winning", "footer", map[string]interface{}{"version": "v2"}, "doppel v2"},
+		{"ignores default data of other templates", "other", map[string]interface{}{"site": "other"}, "other "},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := d.Execute(context.Background(), &buf, tc.name, tc.data); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("returns ErrIncompatibleData for data that can't be merged", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := d.Execute(context.Background(), &buf, "footer", map[string]string{"version": "v2"})
+		if !errors.Is(err, ErrIncompatibleData) {
+			t.Errorf("want ErrIncompatibleData, got: %v", err)
+		}
+		err = d.ExecuteStream(context.Background(), &buf, "footer", "v2", 0)
+		if !errors.Is(err, ErrIncompatibleData) {
+			t.Errorf("ExecuteStream: want ErrIncompatibleData, got: %v", err)
+		}
+		if buf.Len() > 0 {
+			t.Errorf("got output %q, want none", buf.String())
+		}
+	})
+}
+
+func TestLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "page.gohtml")
+	if err := ioutil.WriteFile(path, []byte(`{{.title}} {{.user}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errLoad := errors.New("database unavailable")
+	type ctxKey struct{}
+	d, err := New(ctx, CacheSchematic{
+		"page": {
+			Filepaths: []string{path},
+			Loader: func(ctx context.Context) (interface{}, error) {
+				if err, ok := ctx.Value(ctxKey{}).(error); ok {
+					return nil, err
+				}
+				return map[string]interface{}{"title": "Home", "user": "anon"}, nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc string
+		data interface{}
+		want string
+	}{
+		{"uses loaded data when data is nil", nil, "Home anon"},
+		{"merges maps with per-request keys winning", map[string]interface{}{"user": "angus"}, "Home angus"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := d.Execute(context.Background(), &buf, "page", tc.data); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("returns loader errors as RequestErrors without executing", func(t *testing.T) {
+		var buf bytes.Buffer
+		failing := context.WithValue(context.Background(), ctxKey{}, errLoad)
+		err := d.Execute(failing, &buf, "page", nil)
+		var reqErr RequestError
+		if !errors.As(err, &reqErr) || reqErr.Target != "page" {
+			t.Errorf("want RequestError for page, got: %v", err)
+		}
+		if !errors.Is(err, errLoad) {
+			t.Errorf("want errLoad, got: %v", err)
+		}
+		err = d.ExecuteStream(failing, &buf, "page", nil, 0)
+		if !errors.Is(err, errLoad) {
+			t.Errorf("ExecuteStream: want errLoad, got: %v", err)
+		}
+		if buf.Len() > 0 {
+			t.Errorf("got output %q, want none", buf.String())
+		}
+	})
+
+	t.Run("drops loaders removed by RestoreSchematic", func(t *testing.T) {
+		err := d.RestoreSchematic(context.Background(), CacheSchematic{"page": {Filepaths: []string{path}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		err = d.Execute(context.Background(), &buf, "page", map[string]interface{}{"title": "Away"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := buf.String(), "Away "; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestWithExecuteTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "blocking.gohtml")
+	if err := ioutil.WriteFile(path, []byte(`{{.Value}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newFakeClock()
+	d, err := New(ctx, CacheSchematic{"blocking": {Filepaths: []string{path}}}, WithClock(clk), WithExecuteTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("aborts execution that exceeds the timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+
+		timers := clk.Timers()
+		errStream := make(chan error, 1)
+		var out bytes.Buffer
+		go func() {
+			errStream <- d.Execute(context.Background(), &out, "blocking", blockingData{release})
+		}()
+		waitFor(t, func() bool { return clk.Timers() > timers })
+		clk.Advance(time.Second)
+
+		select {
+		case err := <-errStream:
+			if !errors.Is(err, ErrExecuteTimeout) {
+				t.Errorf("got error %v, want ErrExecuteTimeout", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Execute did not return after the timeout expired")
+		}
+		if out.Len() > 0 {
+			t.Errorf("wrote %q after timing out", out.String())
+		}
+	})
+
+	t.Run("writes output that completes in time", func(t *testing.T) {
+		release := make(chan struct{})
+		close(release)
+
+		var out bytes.Buffer
+		if err := d.Execute(context.Background(), &out, "blocking", blockingData{release}); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != "released" {
+			t.Errorf("got output %q, want %q", got, "released")
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package doppel
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"sync"
+)
+
+// A RequestOption configures a single request made via GetWith.
+type RequestOption func(*request)
+
+// AtGeneration returns a RequestOption that requests the template from the
+// generation identified by g, rather than the current generation. A nil g
+// requests the current generation.
+func AtGeneration(g *Generation) RequestOption {
+	return func(req *request) {
+		if g != nil {
+			req.generation = g.id
+		}
+	}
+}
+
+// GetWith behaves like Get, configuring the request with opts.
+func (d *Doppel) GetWith(ctx context.Context, name string, opts ...RequestOption) (*template.Template, error) {
+	req := &request{name: name}
+	for _, opt := range opts {
+		opt(req)
+	}
+	return d.get(ctx, req)
+}
+
+// A Generation is a handle on the set of templates cached between one Reload
+// and the next. While a Generation is held, requests made with AtGeneration
+// continue to receive its templates after a Reload, so that work begun before
+// a deploy, such as rendering a page from several templates, stays consistent.
+//
+// Only templates cached before the Reload are retained: requests for others
+// fail with ErrGenerationUnavailable. A superseded generation is dropped once
+// every handle on it has been released.
+type Generation struct {
+	d    *Doppel
+	id   uint64
+	once sync.Once
+}
+
+// ID returns the number of the generation, starting from 1 and incremented by
+// each Reload.
+func (g *Generation) ID() uint64 {
+	return g.id
+}
+
+// Release relinquishes the handle, allowing the generation to be dropped if it
+// has been superseded and no other handles remain. Calling Release more than
+// once has no effect.
+func (g *Generation) Release() {
+	g.once.Do(func() {
+		d := g.d
+		d.do(context.Background(), func(map[string]*cacheEntry) {
+			d.generationRefs[g.id]--
+			if d.generationRefs[g.id] > 0 {
+				return
+			}
+			delete(d.generationRefs, g.id)
+			delete(d.retired, g.id)
+		})
+	})
+}
+
+// Acquire returns a handle on the current generation, which must be released
+// once requests no longer need to be bound to it.
+func (d *Doppel) Acquire(ctx context.Context) (*Generation, error) {
+	g := &Generation{d: d}
+	err := d.do(ctx, func(map[string]*cacheEntry) {
+		g.id = d.generation
+		d.generationRefs[g.id]++
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Reload starts a new generation, evicting every cached template and rendered
+// output so that subsequent requests are parsed from the current contents of
+// their files. Templates stored via Inject are kept. If the superseded
+// generation is held by any Generation handle, its cached templates are
+// retained for requests made with AtGeneration until the handles are released.
+// Requests already in progress are unaffected.
+func (d *Doppel) Reload(ctx context.Context) error {
+	return d.do(ctx, func(cache map[string]*cacheEntry) {
+		if d.generationRefs[d.generation] > 0 {
+			retired := make(map[string]*cacheEntry, len(cache))
+			for key, ce := range cache {
+				retired[key] = ce
+			}
+			d.retired[d.generation] = retired
+		}
+		for key := range cache {
+			d.deleteEntry(cache, key)
+			d.emit(EventEvict, key)
+		}
+		if d.renders != nil {
+			d.renders.purge()
+		}
+		d.generation++
+	})
+}
+
+// serveRetired answers a request for a template from a superseded generation
+// on behalf of the cache goroutine.
+func (d *Doppel) serveRetired(req *request) {
+	key := req.key()
+	entry := d.retired[req.generation][key]
+	if entry == nil {
+		d.reject(req, fmt.Errorf("template %q in generation %d: %w", key, req.generation, ErrGenerationUnavailable))
+		return
+	}
+	d.emit(EventHit, key)
+	d.dispatch(entry, req)
+}
@@ -0,0 +1,127 @@
+package doppel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGeneration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "page.gohtml")
+	write := func(t *testing.T, content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	render := func(t *testing.T, d *Doppel, opts ...RequestOption) string {
+		t.Helper()
+		tmpl, err := d.GetWith(context.Background(), "page", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	newDoppel := func(t *testing.T) *Doppel {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		write(t, "v1")
+		d, err := New(ctx, CacheSchematic{
+			"page":  {Filepaths: []string{path}},
+			"other": {Filepaths: []string{path}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	t.Run("held generations survive Reload", func(t *testing.T) {
+		d := newDoppel(t)
+		gen, err := d.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gen.Release()
+		if got := render(t, d, AtGeneration(gen)); got != "v1" {
+			t.Fatalf("got %q, want v1", got)
+		}
+
+		write(t, "v2")
+		if err := d.Reload(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := render(t, d, AtGeneration(gen)); got != "v1" {
+			t.Errorf("held generation: got %q, want v1", got)
+		}
+		if got := render(t, d); got != "v2" {
+			t.Errorf("current generation: got %q, want v2", got)
+		}
+
+		next, err := d.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer next.Release()
+		if next.ID() != gen.ID()+1 {
+			t.Errorf("got generation %d after Reload, want %d", next.ID(), gen.ID()+1)
+		}
+		if got := render(t, d, AtGeneration(next)); got != "v2" {
+			t.Errorf("AtGeneration(current): got %q, want v2", got)
+		}
+	})
+
+	t.Run("templates not cached before Reload are unavailable", func(t *testing.T) {
+		d := newDoppel(t)
+		gen, err := d.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gen.Release()
+		if err := d.Reload(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = d.GetWith(context.Background(), "other", AtGeneration(gen))
+		if !errors.Is(err, ErrGenerationUnavailable) {
+			t.Errorf("want ErrGenerationUnavailable, got: %v", err)
+		}
+	})
+
+	t.Run("released generations are dropped", func(t *testing.T) {
+		d := newDoppel(t)
+		gen, err := d.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		render(t, d, AtGeneration(gen))
+		if err := d.Reload(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		gen.Release()
+		gen.Release() // has no further effect
+		_, err = d.GetWith(context.Background(), "page", AtGeneration(gen))
+		if !errors.Is(err, ErrGenerationUnavailable) {
+			t.Errorf("want ErrGenerationUnavailable, got: %v", err)
+		}
+		if n := len(d.retired); n != 0 {
+			t.Errorf("got %d retired generations, want 0", n)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package doppel
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Glob returns the names of all files matching pattern, in sorted order, for
+// use in a TemplateSchematic's Filepaths. Patterns use the syntax of
+// path.Match, separated by slashes, with the addition of "**", which matches
+// zero or more directories when it forms an entire path element, so that
+// "partials/**/*.gohtml" matches every .gohtml file beneath partials.
+//
+// Glob returns path.ErrBadPattern if pattern is malformed. Unlike
+// filepath.Glob, it returns an error if a directory can't be read.
+func Glob(pattern string) ([]string, error) {
+	root, rest := splitGlob(filepath.ToSlash(pattern))
+	if rest == "" {
+		// No metacharacters: the pattern matches itself, if it exists.
+		if _, err := os.Stat(pattern); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return []string{pattern}, nil
+	}
+
+	dir := filepath.FromSlash(root)
+	if dir == "" {
+		dir = "."
+	}
+	matches, err := GlobFS(os.DirFS(dir), rest)
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range matches {
+		matches[i] = filepath.Join(dir, filepath.FromSlash(m))
+	}
+	return matches, nil
+}
+
+// GlobFS behaves like Glob, but matches the files of fsys, such as those
+// supplied via WithFS. Patterns are unrooted and slash-separated, as for
+// fs.ValidPath.
+func GlobFS(fsys fs.FS, pattern string) ([]string, error) {
+	elems := strings.Split(pattern, "/")
+	for _, elem := range elems {
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	root, _ := splitGlob(pattern)
+	if root == "" {
+		root = "."
+	}
+	var matches []string
+	err := fs.WalkDir(fsys, root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if name == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipDir // nothing to match
+			}
+			return err
+		}
+		if !entry.IsDir() && matchElems(elems, strings.Split(name, "/")) {
+			matches = append(matches, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// splitGlob splits a slash-separated pattern into its leading elements free of
+// metacharacters, which name the directory to search, and the remainder. If
+// the pattern contains no metacharacters, rest is empty.
+func splitGlob(pattern string) (root, rest string) {
+	elems := strings.Split(pattern, "/")
+	for i, elem := range elems {
+		if strings.ContainsAny(elem, `*?[\`) {
+			return strings.Join(elems[:i], "/"), strings.Join(elems[i:], "/")
+		}
+	}
+	return pattern, ""
+}
+
+// matchElems reports whether the elements of a path match those of a pattern,
+// where a "**" element matches any number of path elements.
+func matchElems(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchElems(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0]) // validated by GlobFS
+	return ok && matchElems(pattern[1:], name[1:])
+}
@@ -0,0 +1,90 @@
+package doppel
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGlobFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layout.gohtml":                  {},
+		"partials/flash.gohtml":          {},
+		"partials/nav/main.gohtml":       {},
+		"partials/nav/footer/end.gohtml": {},
+		"partials/nav/notes.txt":         {},
+		"pages/home.gohtml":              {},
+	}
+
+	testCases := []struct {
+		pattern string
+		want    []string
+	}{
+		{"partials/**/*.gohtml", []string{"partials/flash.gohtml", "partials/nav/footer/end.gohtml", "partials/nav/main.gohtml"}},
+		{"partials/*.gohtml", []string{"partials/flash.gohtml"}},
+		{"**/main.gohtml", []string{"partials/nav/main.gohtml"}},
+		{"partials/**/footer/*", []string{"partials/nav/footer/end.gohtml"}},
+		{"**/*.txt", []string{"partials/nav/notes.txt"}},
+		{"*.gohtml", []string{"layout.gohtml"}},
+		{"missing/**/*.gohtml", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			got, err := GlobFS(fsys, tc.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("rejects malformed patterns", func(t *testing.T) {
+		if _, err := GlobFS(fsys, "partials/**/[.gohtml"); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("got error %v, want path.ErrBadPattern", err)
+		}
+	})
+}
+
+func TestGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var want []string
+	for _, name := range []string{"a.gohtml", "nested/b.gohtml", "nested/deeper/c.gohtml"} {
+		file := filepath.Join(dir, "partials", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, file)
+	}
+
+	got, err := Glob(filepath.Join(dir, "partials", "**", "*.gohtml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got, err = Glob(want[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("literal pattern: got %v, want %v", got, want[:1])
+	}
+}
@@ -3,8 +3,7 @@ package doppel
 import (
 	"context"
 	"html/template"
-
-	"github.com/pkg/errors"
+	"time"
 )
 
 // globalCache supports package-level template composition and
@@ -14,13 +13,13 @@ var globalCache *Doppel
 // Initialize starts the default, global cache. Attempting to perform operations
 // like Get on the global cache before it is initialized will return an error.
 //
-// The user is responsible for closing the global cache via the context param.
+// The global cache shuts down when ctx is done or Close or Shutdown is called.
 func Initialize(ctx context.Context, schematic CacheSchematic, opts ...CacheOption) error {
 	if globalCache != nil {
 		select {
 		case <-globalCache.done:
 		default:
-			return errors.WithStack(ErrAlreadyInitialized)
+			return ErrAlreadyInitialized
 		}
 	}
 
@@ -35,8 +34,29 @@ func Initialize(ctx context.Context, schematic CacheSchematic, opts ...CacheOpti
 // If Get is called before Initialize, ErrNotInitialized is returned.
 func Get(ctx context.Context, name string) (*template.Template, error) {
 	if globalCache == nil {
-		return nil, errors.WithStack(ErrNotInitialized)
+		return nil, ErrNotInitialized
 	}
 
 	return globalCache.Get(ctx, name)
 }
+
+// Close shuts down the global cache, as for Doppel.Close. If Close is called
+// before Initialize, ErrNotInitialized is returned.
+func Close() error {
+	if globalCache == nil {
+		return ErrNotInitialized
+	}
+
+	return globalCache.Close()
+}
+
+// Shutdown shuts down the global cache after a grace period, as for
+// Doppel.Shutdown. If Shutdown is called before Initialize, ErrNotInitialized
+// is returned.
+func Shutdown(gracePeriod time.Duration) error {
+	if globalCache == nil {
+		return ErrNotInitialized
+	}
+
+	return globalCache.Shutdown(gracePeriod)
+}
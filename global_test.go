@@ -2,9 +2,10 @@ package doppel
 
 import (
 	"context"
+	"errors"
+	"io"
 	"testing"
-
-	"github.com/pkg/errors"
+	"time"
 )
 
 func TestInitialize(t *testing.T) {
@@ -32,7 +33,7 @@ func TestInitialize(t *testing.T) {
 		}
 
 		err = Initialize(ctx, schematic)
-		if errors.Cause(err) != ErrAlreadyInitialized {
+		if !errors.Is(err, ErrAlreadyInitialized) {
 			t.Errorf("got error %q, want ErrAlreadyInitialized", err)
 		}
 	})
@@ -67,8 +68,102 @@ func TestGlobalGet(t *testing.T) {
 	t.Run("returns an error if called before Initialize", func(t *testing.T) {
 		globalCache = nil
 		_, err := Get(context.Background(), "base")
-		if errors.Cause(err) != ErrNotInitialized {
+		if !errors.Is(err, ErrNotInitialized) {
 			t.Errorf("got err %q, want ErrNotInitialized", err)
 		}
 	})
 }
+
+func TestGlobalClose(t *testing.T) {
+	t.Run("returns ErrNotInitialized before Initialize", func(t *testing.T) {
+		defer func(prev *Doppel) { globalCache = prev }(globalCache)
+		globalCache = nil
+
+		if err := Close(); !errors.Is(err, ErrNotInitialized) {
+			t.Errorf("got error %v, want ErrNotInitialized", err)
+		}
+	})
+
+	t.Run("shuts down the global cache", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if err := Initialize(ctx, schematic); err != nil && !errors.Is(err, ErrAlreadyInitialized) {
+			t.Fatal(err)
+		}
+
+		if err := Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Get(context.Background(), "base"); !errors.Is(err, ErrDoppelShutdown) {
+			t.Errorf("got error %v, want ErrDoppelShutdown", err)
+		}
+		if err := Initialize(ctx, schematic); err != nil {
+			t.Errorf("got error %v reinitializing after Close, want nil", err)
+		}
+	})
+}
+
+func TestGlobalShutdown(t *testing.T) {
+	t.Run("returns ErrNotInitialized before Initialize", func(t *testing.T) {
+		defer func(prev *Doppel) { globalCache = prev }(globalCache)
+		globalCache = nil
+
+		if err := Shutdown(time.Second); !errors.Is(err, ErrNotInitialized) {
+			t.Errorf("got error %v, want ErrNotInitialized", err)
+		}
+	})
+
+	// initialize starts a global cache whose reads block until release is
+	// closed, and begins parsing base.
+	initialize := func(t *testing.T, release chan struct{}, clk Clock) {
+		t.Helper()
+		slowOpen := OptionFunc(func(d *Doppel) {
+			d.open = func(string) (io.ReadCloser, error) {
+				return &slowReader{release}, nil
+			}
+		})
+		if err := Initialize(context.Background(), schematic, slowOpen, WithClock(clk)); err != nil {
+			t.Fatal(err)
+		}
+		go Get(context.Background(), "base")
+		waitFor(t, func() bool { return len(globalCache.InFlight()) == 1 })
+	}
+
+	t.Run("waits for parses that finish within the grace period", func(t *testing.T) {
+		defer func(prev *Doppel) { globalCache = prev }(globalCache)
+		globalCache = nil
+
+		release := make(chan struct{})
+		clk := newFakeClock()
+		initialize(t, release, clk)
+
+		errStream := make(chan error)
+		go func() { errStream <- Shutdown(time.Hour) }()
+		waitFor(t, func() bool { return clk.Timers() > 0 })
+		close(release)
+		if err := <-errStream; err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+		if _, err := Get(context.Background(), "base"); !errors.Is(err, ErrDoppelShutdown) {
+			t.Errorf("got error %v, want ErrDoppelShutdown", err)
+		}
+	})
+
+	t.Run("abandons parses once the grace period expires", func(t *testing.T) {
+		defer func(prev *Doppel) { globalCache = prev }(globalCache)
+		globalCache = nil
+
+		release := make(chan struct{})
+		defer close(release)
+		clk := newFakeClock()
+		initialize(t, release, clk)
+
+		errStream := make(chan error)
+		go func() { errStream <- Shutdown(time.Hour) }()
+		waitFor(t, func() bool { return clk.Timers() > 0 })
+		clk.Advance(time.Hour)
+		if err := <-errStream; !errors.Is(err, ErrRequestsAbandoned) {
+			t.Errorf("got error %v, want ErrRequestsAbandoned", err)
+		}
+	})
+}
@@ -1,5 +1,3 @@
 module github.com/angusgmorrison/doppel
 
-go 1.15
-
-require github.com/pkg/errors v0.9.1
+go 1.20
@@ -0,0 +1,51 @@
+package doppel
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+)
+
+// Inject stores a copy of tmpl, parsed outside the Doppel, in the cache as the
+// ready template name. Templates whose BaseTmplName is name are composed from
+// the injected template in place of parsing name's files, and any of them
+// already cached are evicted, along with their cached output, so that they are
+// reparsed when next requested.
+//
+// An injected template has no base template or includes of its own, so Inject
+// replaces name's TemplateSchematic, if any, with an empty one. Injected
+// templates are never reparsed, and persist until the next call to
+// RestoreSchematic. Inject returns an error if tmpl is nil or has already been
+// executed.
+func (d *Doppel) Inject(name string, tmpl *template.Template) error {
+	name = d.canonical(name)
+	if tmpl == nil {
+		return fmt.Errorf("injecting %q: %w", name, ErrNilTemplate)
+	}
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+
+	return d.do(context.Background(), func(cache map[string]*cacheEntry) {
+		cs := make(CacheSchematic, len(d.schematic)+1)
+		for k, v := range d.schematic {
+			cs[k] = v
+		}
+		// An empty TemplateSchematic has no dependencies, so replacing
+		// name's can't introduce a cycle.
+		cs[name] = &TemplateSchematic{}
+
+		d.schematic = cs
+		d.loaders.Delete(name)
+		if d.injected == nil {
+			d.injected = make(map[string]*template.Template)
+		}
+		d.injected[name] = clone
+		if d.stats[name] == nil {
+			d.stats[name] = &templateStats{}
+		}
+
+		d.evict(cache, name)
+	})
+}
@@ -0,0 +1,122 @@
+package doppel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestInject(t *testing.T) {
+	execute := func(t *testing.T, d *Doppel, name string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := d.Execute(context.Background(), &buf, name, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	newNav := func(t *testing.T) *template.Template {
+		t.Helper()
+		tmpl, err := template.New("custom").Parse(`[{{template "nav"}}|{{template "body"}}]{{define "nav"}}injected nav{{end}}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tmpl
+	}
+
+	t.Run("children are composed from the injected template", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		before := execute(t, d, "withBody1") // cache withBody1 before injecting its base
+		nav := newNav(t)
+		if err := d.Inject("commonNav", nav); err != nil {
+			t.Fatal(err)
+		}
+		// Modifying the original must not affect the injected copy.
+		template.Must(nav.New("nav").Parse("modified nav"))
+
+		got := execute(t, d, "withBody1")
+		if got == before {
+			t.Fatal("cached child was not evicted")
+		}
+		if !strings.HasPrefix(got, "[injected nav|") || !strings.Contains(got, "first of two") {
+			t.Errorf("got output %q, want the injected template composed with body 1", got)
+		}
+		if got := execute(t, d, "withBody2"); !strings.HasPrefix(got, "[injected nav|") {
+			t.Errorf("got output %q, want the injected template composed with body 2", got)
+		}
+	})
+
+	t.Run("injected templates need not appear in the schematic", func(t *testing.T) {
+		cs := schematic.Clone()
+		cs["withBody1"].BaseTmplName = "external"
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := New(ctx, cs, WithSinglePassParsing())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Inject("external", newNav(t)); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := execute(t, d, "withBody1"); !strings.HasPrefix(got, "[injected nav|") {
+			t.Errorf("got output %q, want the injected template", got)
+		}
+	})
+
+	t.Run("RestoreSchematic discards injected templates", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Inject("commonNav", newNav(t)); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.RestoreSchematic(context.Background(), schematic); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := execute(t, d, "withBody1"); strings.Contains(got, "injected nav") {
+			t.Errorf("got output %q, want the schematic's template", got)
+		}
+	})
+
+	t.Run("nil template", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Inject("commonNav", nil); !errors.Is(err, ErrNilTemplate) {
+			t.Errorf("got error %v, want ErrNilTemplate", err)
+		}
+	})
+
+	t.Run("shut down Doppel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		<-d.heartbeat // wait for the cache goroutine to exit
+
+		if err := d.Inject("commonNav", newNav(t)); !errors.Is(err, ErrDoppelShutdown) {
+			t.Errorf("got error %v, want ErrDoppelShutdown", err)
+		}
+	})
+}
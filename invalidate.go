@@ -0,0 +1,87 @@
+package doppel
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// Invalidate evicts the named template from the cache, along with every
+// template that depends on it, whether as a base template or an include, and
+// all of their locale variants. Any output of these templates cached by
+// ExecuteCached is discarded. Evicted templates are reparsed when next
+// requested. Requests already in progress are unaffected.
+func (d *Doppel) Invalidate(ctx context.Context, name string) error {
+	name = d.canonical(name)
+	return d.do(ctx, func(cache map[string]*cacheEntry) {
+		d.evict(cache, name)
+	})
+}
+
+// InvalidateFile evicts every cached template composed from the file at path,
+// whether it belongs to the template itself, one of its base templates or an
+// include, and returns the number of entries evicted, counting locale variants
+// separately. Any output of the evicted templates cached by ExecuteCached is
+// discarded. Paths are compared after cleaning, so path must be relative to
+// the same directory as those of the schematic. A path that no cached template
+// uses evicts nothing. Requests already in progress are unaffected.
+func (d *Doppel) InvalidateFile(ctx context.Context, path string) (int, error) {
+	return d.InvalidateFiles(ctx, path)
+}
+
+// InvalidateFiles behaves like InvalidateFile for each of paths, such as the
+// files changed by a deploy or reported by a file watcher, in a single
+// operation on the cache. It returns the number of entries evicted, counting
+// each entry once however many of paths it was composed from.
+func (d *Doppel) InvalidateFiles(ctx context.Context, paths ...string) (int, error) {
+	var evicted int
+	err := d.do(ctx, func(cache map[string]*cacheEntry) {
+		for _, path := range paths {
+			evicted += d.evictFile(cache, filepath.Clean(path))
+		}
+	})
+	return evicted, err
+}
+
+// evictFile removes every entry composed from the file at the cleaned path
+// from cache, along with the rendered output of their templates, returning the
+// number of entries removed. It must be called from the cache goroutine.
+func (d *Doppel) evictFile(cache map[string]*cacheEntry, path string) int {
+	keys := d.fileIndex[path]
+	if len(keys) == 0 {
+		return 0
+	}
+
+	names := make(map[string]bool, len(keys))
+	evict := make([]string, 0, len(keys))
+	for key := range keys {
+		names[cache[key].name] = true
+		evict = append(evict, key)
+	}
+	if d.renders != nil {
+		d.renders.invalidate(names)
+	}
+	for _, key := range evict {
+		d.log.Printf(logEvictingTemplate, key)
+		d.deleteEntry(cache, key)
+		d.emit(EventEvict, key)
+	}
+	return len(evict)
+}
+
+// evict removes the named template, every template that depends on it and all
+// of their locale variants from cache, along with their rendered output. It
+// must be called from the cache goroutine.
+func (d *Doppel) evict(cache map[string]*cacheEntry, name string) {
+	evict := d.schematic.dependents(name)
+	evict[name] = true
+	if d.renders != nil {
+		d.renders.invalidate(evict)
+	}
+	for key, ce := range cache {
+		if evict[ce.name] {
+			d.log.Printf(logEvictingTemplate, key)
+			d.deleteEntry(cache, key)
+			d.emit(EventEvict, key)
+		}
+	}
+}
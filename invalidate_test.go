@@ -0,0 +1,157 @@
+package doppel
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInvalidate(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		invalidate string
+		wantKept   []string
+	}{
+		{"evicts the template and its dependents", "commonNav", []string{"base"}},
+		{"evicts only the named leaf template", "withBody1", []string{"base", "commonNav", "withBody2"}},
+		{"evicts nothing for unknown names", "unknown", []string{"base", "commonNav", "withBody1", "withBody2"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d, err := New(ctx, schematic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"withBody1", "withBody2"} {
+				if _, err := d.Get(context.Background(), name); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := d.Invalidate(context.Background(), tc.invalidate); err != nil {
+				t.Fatal(err)
+			}
+
+			snap, err := d.Snapshot(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snap.Entries) != len(tc.wantKept) {
+				t.Fatalf("got %d entries, want %v", len(snap.Entries), tc.wantKept)
+			}
+			for i, es := range snap.Entries {
+				if es.Name != tc.wantKept[i] {
+					t.Errorf("got entry %q, want %q", es.Name, tc.wantKept[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidateFile(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		path     string
+		wantKept []string
+	}{
+		{"evicts templates composed from the file", navpath, []string{"base"}},
+		{"evicts only the template that owns a leaf file", body1Path, []string{"base", "commonNav", "withBody2"}},
+		{"cleans the path", filepath.Join(fixtures, "..", filepath.Base(fixtures), "base.gohtml"), nil},
+		{"evicts nothing for unused files", filepath.Join(fixtures, "unused.gohtml"), []string{"base", "commonNav", "withBody1", "withBody2"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d, err := New(ctx, schematic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"withBody1", "withBody2"} {
+				if _, err := d.Get(context.Background(), name); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			evicted, err := d.InvalidateFile(context.Background(), tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := 4 - len(tc.wantKept); evicted != want {
+				t.Errorf("got %d entries evicted, want %d", evicted, want)
+			}
+
+			snap, err := d.Snapshot(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kept []string
+			for _, es := range snap.Entries {
+				kept = append(kept, es.Name)
+			}
+			if !reflect.DeepEqual(kept, tc.wantKept) {
+				t.Errorf("got entries %v, want %v", kept, tc.wantKept)
+			}
+		})
+	}
+
+	t.Run("forgets the files of evicted and replaced entries", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ { // dev mode replaces the entry on each request
+			if _, err := d.Get(context.Background(), "base"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := d.Invalidate(context.Background(), "base"); err != nil {
+			t.Fatal(err)
+		}
+
+		err = d.do(context.Background(), func(map[string]*cacheEntry) {
+			if len(d.fileIndex) != 0 {
+				t.Errorf("got file index %v, want empty", d.fileIndex)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestInvalidateFiles(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"withBody1", "withBody2"} {
+		if _, err := d.Get(context.Background(), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	evicted, err := d.InvalidateFiles(context.Background(), body1Path, navpath, body2Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evicted != 3 {
+		t.Errorf("got %d entries evicted, want 3", evicted)
+	}
+	if _, err := d.TryGet("base"); err != nil {
+		t.Errorf("base was evicted: %v", err)
+	}
+}
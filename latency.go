@@ -0,0 +1,68 @@
+package doppel
+
+import "time"
+
+// Latency breaks down the time taken to serve a request, as logged when
+// WithLatencyLogging is supplied.
+type Latency struct {
+	Queue time.Duration // waiting for the cache goroutine to accept the request
+	Parse time.Duration // waiting for the template to be parsed; zero if it was already cached
+	Clone time.Duration // copying the cached template for the caller
+	Total time.Duration // including time not attributed above, such as scheduling delays
+}
+
+// requestTiming records the timestamps from which a request's Latency is
+// calculated. Each is zero until the request reaches the corresponding stage.
+type requestTiming struct {
+	dequeued     time.Time // accepted by the cache goroutine
+	parseStarted time.Time // the start of the entry's most recent parse
+	parseEnded   time.Time // the end of the entry's most recent parse
+	cloneStarted time.Time
+	delivered    time.Time
+}
+
+// latency calculates req's Latency as of its delivery, or of now if it was
+// never delivered. It returns nil unless latency logging is enabled.
+func (d *Doppel) latency(req *request) *Latency {
+	t := req.timing
+	if t == nil {
+		return nil
+	}
+	end := t.delivered
+	if end.IsZero() {
+		end = d.clock.Now()
+	}
+
+	l := &Latency{Total: end.Sub(req.start), Queue: end.Sub(req.start)}
+	if t.dequeued.IsZero() {
+		return l // never left the queue
+	}
+	l.Queue = t.dequeued.Sub(req.start)
+	if t.parseEnded.After(t.dequeued) {
+		// Only parsing that the request waited for counts against it.
+		from := t.parseStarted
+		if from.Before(t.dequeued) {
+			from = t.dequeued
+		}
+		l.Parse = t.parseEnded.Sub(from)
+	}
+	if !t.delivered.IsZero() {
+		l.Clone = t.delivered.Sub(t.cloneStarted)
+	}
+	return l
+}
+
+// logLatency logs a summary of the completed request's Latency, if latency
+// logging is enabled, and returns it.
+func (d *Doppel) logLatency(req *request, err error) *Latency {
+	l := d.latency(req)
+	if l == nil {
+		return nil
+	}
+	outcome := "served"
+	if err != nil {
+		outcome = "failed"
+	}
+	d.log.Printf(logRequestLatency, req.key(), outcome, l.Total, l.Queue, l.Parse, l.Clone)
+	return l
+}
@@ -0,0 +1,91 @@
+package doppel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithLatencyLogging(t *testing.T) {
+	const readDelay = 20 * time.Millisecond
+	slowOpen := OptionFunc(func(d *Doppel) {
+		d.open = func(path string) (io.ReadCloser, error) {
+			time.Sleep(readDelay)
+			return openFile(path)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := &testLogger{out: &bytes.Buffer{}}
+	d, err := New(ctx, schematic, WithLogger(logger), WithLatencyLogging(), slowOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("misses are attributed to parsing", func(t *testing.T) {
+		if _, err := d.Get(context.Background(), "base"); err != nil {
+			t.Fatal(err)
+		}
+		if out := logger.String(); !strings.Contains(out, `request for template "base" served after`) {
+			t.Errorf("missing latency summary:\n%s", out)
+		}
+	})
+
+	t.Run("RequestErrors carry the breakdown", func(t *testing.T) {
+		_, err := d.Get(context.Background(), "missing")
+		var reqErr RequestError
+		if !errors.As(err, &reqErr) {
+			t.Fatalf("got error %v, want a RequestError", err)
+		}
+		l := reqErr.Latency
+		if l == nil {
+			t.Fatal("got nil Latency")
+		}
+		if l.Total < l.Queue+l.Parse+l.Clone {
+			t.Errorf("got Total %v, less than the sum of its parts in %+v", l.Total, *l)
+		}
+	})
+
+	t.Run("breaks down latency", func(t *testing.T) {
+		// Parse withBody1's own file, having cached its bases.
+		if _, err := d.Get(context.Background(), "commonNav"); err != nil {
+			t.Fatal(err)
+		}
+		req := &request{name: "withBody1"}
+		if _, err := d.get(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		miss := d.latency(req)
+		if miss.Parse < readDelay {
+			t.Errorf("got Parse %v for a miss, want at least %v", miss.Parse, readDelay)
+		}
+		if miss.Total < miss.Queue+miss.Parse+miss.Clone {
+			t.Errorf("got Total %v, less than the sum of its parts in %+v", miss.Total, *miss)
+		}
+
+		req = &request{name: "withBody1"}
+		if _, err := d.get(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		if hit := d.latency(req); hit.Parse != 0 {
+			t.Errorf("got Parse %v for a hit, want 0", hit.Parse)
+		}
+	})
+
+	t.Run("is off by default", func(t *testing.T) {
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = d.Get(context.Background(), "missing")
+		var reqErr RequestError
+		if !errors.As(err, &reqErr) || reqErr.Latency != nil {
+			t.Errorf("got error %#v, want a RequestError without Latency", err)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package doppel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParseSchematicJSON reads a CacheSchematic from r, encoded as a JSON object
+// mapping template names to TemplateSchematics, e.g.
+//
+//	{"base": {"Filepaths": ["base.gohtml"]}, "nav": {"BaseTmplName": "base", "Filepaths": ["nav.gohtml"]}}
+//
+// Unknown fields are rejected, so that misspelled field names aren't silently
+// ignored. As for ParseSchematicText, the returned CacheSchematic is not
+// otherwise validated.
+func ParseSchematicJSON(r io.Reader) (CacheSchematic, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var cs CacheSchematic
+	if err := dec.Decode(&cs); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSchematicSyntax)
+	}
+	if cs == nil {
+		cs = make(CacheSchematic)
+	}
+	return cs, nil
+}
+
+// LoadSchematic reads a CacheSchematic from the file at path: as JSON, via
+// ParseSchematicJSON, if its extension is .json, and otherwise in the text
+// format read by ParseSchematicText.
+func LoadSchematic(path string) (CacheSchematic, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cs CacheSchematic
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		cs, err = ParseSchematicJSON(f)
+	default:
+		cs, err = ParseSchematicText(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cs, nil
+}
@@ -0,0 +1,75 @@
+package doppel
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSchematicJSON(t *testing.T) {
+	t.Run("reads a schematic", func(t *testing.T) {
+		got, err := ParseSchematicJSON(strings.NewReader(`{
+			"base": {"Filepaths": ["base.gohtml"]},
+			"nav":  {"BaseTmplName": "base", "Filepaths": ["nav.gohtml"], "Internal": true}
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := CacheSchematic{
+			"base": {Filepaths: []string{"base.gohtml"}},
+			"nav":  {BaseTmplName: "base", Filepaths: []string{"nav.gohtml"}, Internal: true},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("rejects unknown fields", func(t *testing.T) {
+		_, err := ParseSchematicJSON(strings.NewReader(`{"base": {"Files": ["base.gohtml"]}}`))
+		if !errors.Is(err, ErrSchematicSyntax) {
+			t.Errorf("want ErrSchematicSyntax, got: %v", err)
+		}
+	})
+}
+
+func TestLoadSchematic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := CacheSchematic{
+		"base": {Filepaths: []string{"base.gohtml"}},
+		"nav":  {BaseTmplName: "base", Filepaths: []string{"nav.gohtml"}},
+	}
+	files := map[string]string{
+		"schematic.json": `{"base": {"Filepaths": ["base.gohtml"]}, "nav": {"BaseTmplName": "base", "Filepaths": ["nav.gohtml"]}}`,
+		"schematic.txt":  "base: base.gohtml\nnav: base -> nav.gohtml\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadSchematic(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	t.Run("returns an error for missing files", func(t *testing.T) {
+		if _, err := LoadSchematic(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("want os.ErrNotExist, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package doppel
+
+import (
+	"context"
+	"html/template"
+)
+
+// A Localizer returns the functions and files that distinguish the locale
+// variant of the named template. The functions are added to a copy of the
+// named template before the files are parsed, so they may be used by the
+// locale's files and override same-named functions in the original.
+type Localizer func(name, locale string) (template.FuncMap, []string)
+
+// GetLocalized returns the locale variant of a named template, composing it
+// from the named template and the functions and files provided by the
+// Doppel's Localizer. Each variant is cached separately, and invalidating the
+// named template invalidates all of its variants.
+//
+// If the Doppel has no Localizer, or locale is empty, GetLocalized is
+// equivalent to Get.
+func (d *Doppel) GetLocalized(ctx context.Context, name, locale string) (*template.Template, error) {
+	if d.localizer == nil || locale == "" {
+		return d.Get(ctx, name)
+	}
+	name = d.canonical(name)
+
+	funcs, files := d.localizer(name, locale)
+	return d.get(ctx, &request{
+		name:        name,
+		locale:      locale,
+		localeFuncs: funcs,
+		localeFiles: files,
+	})
+}
+
+// localizedKey returns the cache key for the locale variant of a template.
+func localizedKey(name, locale string) string {
+	return name + "[" + locale + "]"
+}
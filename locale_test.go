@@ -0,0 +1,109 @@
+package doppel
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetLocalized(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	frBodyPath := filepath.Join(dir, "body_fr.gohtml")
+	err = ioutil.WriteFile(frBodyPath, []byte(`{{define "body"}}{{greeting}}{{end}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	localizer := func(name, locale string) (template.FuncMap, []string) {
+		if locale != "fr" {
+			return nil, nil
+		}
+		funcs := template.FuncMap{"greeting": func() string { return "Bonjour" }}
+		return funcs, []string{frBodyPath}
+	}
+
+	execute := func(tmpl *template.Template) string {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, schematic, WithLocalizer(localizer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("composes locale variants from the named template", func(t *testing.T) {
+		fr, err := d.GetLocalized(context.Background(), "withBody1", "fr")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := execute(fr); !strings.Contains(got, "Bonjour") {
+			t.Errorf("fr variant does not contain localized body: %s", got)
+		}
+
+		en, err := d.GetLocalized(context.Background(), "withBody1", "en")
+		if err != nil {
+			t.Fatal(err)
+		}
+		original, err := d.Get(context.Background(), "withBody1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if execute(en) != execute(original) {
+			t.Error("en variant differs from the original template")
+		}
+	})
+
+	t.Run("caches each variant separately", func(t *testing.T) {
+		snap, err := d.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]bool{
+			localizedKey("withBody1", "fr"): false,
+			localizedKey("withBody1", "en"): false,
+			"withBody1":                     false,
+		}
+		for _, es := range snap.Entries {
+			if _, ok := want[es.Name]; ok {
+				want[es.Name] = true
+			}
+		}
+		for key, found := range want {
+			if !found {
+				t.Errorf("%q was not cached", key)
+			}
+		}
+	})
+
+	t.Run("invalidating a base template invalidates its variants", func(t *testing.T) {
+		if err := d.Invalidate(context.Background(), "base"); err != nil {
+			t.Fatal(err)
+		}
+
+		snap, err := d.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snap.Entries) != 0 {
+			t.Errorf("got %d entries after invalidation, want 0", len(snap.Entries))
+		}
+	})
+}
@@ -1,7 +1,16 @@
 package doppel
 
-type logger interface {
-	Printf(fmt string, args ...interface{})
+import "sync/atomic"
+
+// A Logger receives a message for each stage of a request's progress through
+// the cache. Printf is called with a format string and arguments in the manner
+// of fmt.Printf; format strings have no trailing newline, so implementations
+// should append one if required, as *log.Logger does. Template names are
+// always passed as arguments, never as part of the format string.
+//
+// Printf may be called concurrently from multiple goroutines.
+type Logger interface {
+	Printf(format string, args ...interface{})
 }
 
 // defaultLog provides a no-op logger to avoid a series of nil checks throughout
@@ -11,3 +20,48 @@ type defaultLog struct{}
 func (d *defaultLog) Printf(format string, args ...interface{}) {
 	// No-op.
 }
+
+// A logSampler thins out high-volume log messages, passing one in every n.
+type logSampler struct {
+	count uint64 // messages seen; accessed atomically, and first for 64-bit alignment
+	n     uint64
+}
+
+// sample reports whether the current message should be logged. The first
+// message is always logged.
+func (ls *logSampler) sample() bool {
+	return (atomic.AddUint64(&ls.count, 1)-1)%ls.n == 0
+}
+
+// logSampled logs a per-request message about the template cached under key,
+// subject to sampling configured via WithLogSampling. Parse results and errors
+// are logged via d.log directly. key is boxed for Printf only once a message
+// is to be logged, so that the hit path doesn't allocate when logging is off.
+func (d *Doppel) logSampled(format, key string) {
+	if _, off := d.log.(*defaultLog); off {
+		return
+	}
+	if d.logSampler != nil && !d.logSampler.sample() {
+		return
+	}
+	d.log.Printf(format, key)
+}
+
+// logQueued numbers req and logs that it is being sent to the cache, if queue
+// logging is enabled via WithQueueLogging.
+func (d *Doppel) logQueued(req *request) {
+	if !d.logQueue {
+		return
+	}
+	req.id = d.requestSeq.Add(1)
+	d.log.Printf(logRequestQueued, req.id, req.key())
+}
+
+// logDequeued logs the time req spent waiting for the cache goroutine, if it
+// was numbered by logQueued.
+func (d *Doppel) logDequeued(req *request) {
+	if req.id == 0 {
+		return
+	}
+	d.log.Printf(logRequestDequeued, req.id, req.key(), d.since(req.start))
+}
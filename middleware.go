@@ -0,0 +1,31 @@
+package doppel
+
+import (
+	"context"
+	"net/http"
+)
+
+// contextKey is unexported to prevent collisions with context keys defined in
+// other packages.
+type contextKey int
+
+const doppelKey contextKey = iota
+
+// Middleware returns HTTP middleware that stores d in each request's context,
+// from which it can be retrieved with FromContext. Handlers should pass the
+// request's context to d.Get so that retrieval is bounded by the lifetime of
+// the request.
+func Middleware(d *Doppel) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), doppelKey, d)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// FromContext returns the *Doppel stored in ctx by Middleware, if any.
+func FromContext(ctx context.Context) (*Doppel, bool) {
+	d, ok := ctx.Value(doppelKey).(*Doppel)
+	return d, ok
+}
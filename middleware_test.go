@@ -0,0 +1,39 @@
+package doppel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Run("stores the *Doppel in the request context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got *Doppel
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _ = FromContext(r.Context())
+		})
+		Middleware(d)(handler).ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if got != d {
+			t.Errorf("got *Doppel %p, want %p", got, d)
+		}
+	})
+}
+
+func TestFromContext(t *testing.T) {
+	t.Run("reports false if no *Doppel is present", func(t *testing.T) {
+		if d, ok := FromContext(context.Background()); ok || d != nil {
+			t.Errorf("got (%v, %t), want (nil, false)", d, ok)
+		}
+	})
+}
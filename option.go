@@ -1,27 +1,86 @@
 package doppel
 
-import "time"
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"time"
+)
 
 // CacheOption are used to decorate new Doppels, e.g. adding template
-// expiry or memory limits.
-type CacheOption func(*Doppel)
+// expiry or memory limits. An option that is given an invalid configuration
+// returns an error, which New reports before the cache is started.
+type CacheOption func(*Doppel) error
+
+// OptionFunc adapts a function that configures a Doppel and can't fail to a
+// CacheOption.
+func OptionFunc(fn func(*Doppel)) CacheOption {
+	return func(d *Doppel) error {
+		fn(d)
+		return nil
+	}
+}
+
+// invalidOption returns an error identifying the named option and describing
+// why its configuration is invalid.
+func invalidOption(option, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s: %w", option, fmt.Sprintf(format, args...), ErrInvalidOption)
+}
 
 // WithGlobalTimeout returns a CacheOption that sets a maximum
-// runtime for all requests made to the Doppel.
+// runtime for all requests made to the Doppel. The timeout must not be
+// negative; zero disables it.
 func WithGlobalTimeout(timeout time.Duration) CacheOption {
-	return func(d *Doppel) {
+	return func(d *Doppel) error {
+		if timeout < 0 {
+			return invalidOption("WithGlobalTimeout", "negative timeout %v", timeout)
+		}
 		d.globalTimeout = timeout
+		return nil
 	}
 }
 
 // WithLogger allows the user to specify a logger to be embedded in the Doppel.
-func WithLogger(log logger) CacheOption {
-	return func(d *Doppel) {
+// The logger must not be nil.
+func WithLogger(log Logger) CacheOption {
+	return func(d *Doppel) error {
+		if log == nil {
+			return invalidOption("WithLogger", "nil Logger")
+		}
 		d.log = log
+		return nil
+	}
+}
+
+// WithStdLogger logs cache operations to l, which must not be nil.
+func WithStdLogger(l *log.Logger) CacheOption {
+	return func(d *Doppel) error {
+		if l == nil {
+			return invalidOption("WithStdLogger", "nil *log.Logger")
+		}
+		d.log = l
+		return nil
+	}
+}
+
+// WithWriterLogger logs cache operations to w, one line per message, with each
+// line beginning with prefix and the standard log flags. w must not be nil.
+func WithWriterLogger(w io.Writer, prefix string) CacheOption {
+	return func(d *Doppel) error {
+		if w == nil {
+			return invalidOption("WithWriterLogger", "nil io.Writer")
+		}
+		d.log = log.New(w, prefix, log.LstdFlags)
+		return nil
 	}
 }
 
 const (
+	logRequestQueued         = "queueing request %d for template %q"
+	logRequestDequeued       = "serving request %d for template %q after %v in queue"
 	logRequestReceived       = "received request for template %q"
 	logRequestInterrupted    = "request for template %q interrupted"
 	logParsingTemplate       = "parsing template %q"
@@ -32,13 +91,657 @@ const (
 	logDeliveringCachedError = "delivering cached error for template %q"
 	logCloningError          = "error cloning template %q: %v"
 	logDeliveringTemplate    = "delivering template %q"
+	logEvictingTemplate      = "evicting template %q"
+	logWarmingTemplate       = "copying template %q from warm source"
+	logCachePanic            = "cache goroutine panicked, shutting down: %v"
+	logRequestLatency        = "request for template %q %s after %v: queue %v, parse %v, clone %v"
+	logRequestInternal       = "rejecting request for internal template %q"
+	logInternalUnused        = "internal template %q is not a base or include of any other template"
+	logRenderFailed          = "rendering template %q failed: %v"
+	logRenderCutShort        = "rendering template %q failed after output was sent: %v"
+	logSlowParse             = "parsing template %q took %v, exceeding the slow parse threshold of %v"
 )
 
+// WithTemplateTimeouts returns a CacheOption that limits the runtime of
+// requests for the named templates, e.g. from configuration. Requests are
+// bound by both their template's timeout and the global timeout, if any, so
+// the tighter of the two applies. Templates absent from timeouts, or whose
+// timeout is zero, are bound by the global timeout alone. Timeouts must not be
+// negative.
+//
+// timeouts is copied, so later changes to it have no effect.
+func WithTemplateTimeouts(timeouts map[string]time.Duration) CacheOption {
+	copied := make(map[string]time.Duration, len(timeouts))
+	for name, timeout := range timeouts {
+		copied[name] = timeout
+	}
+	return func(d *Doppel) error {
+		for name, timeout := range copied {
+			if timeout < 0 {
+				return invalidOption("WithTemplateTimeouts", "timeout %v for template %q is negative", timeout, name)
+			}
+		}
+		d.templateTimeouts = copied
+		return nil
+	}
+}
+
+// WithSlowParseThreshold returns a CacheOption that logs a message and emits
+// EventSlowParse for every parse that takes longer than threshold, including
+// time spent retrieving the base template, to identify the templates for which
+// reparsing, e.g. in dev mode or after invalidation, is expensive. The
+// threshold must not be negative; zero disables it.
+func WithSlowParseThreshold(threshold time.Duration) CacheOption {
+	return func(d *Doppel) error {
+		if threshold < 0 {
+			return invalidOption("WithSlowParseThreshold", "negative threshold %v", threshold)
+		}
+		d.slowParseThreshold = threshold
+		return nil
+	}
+}
+
+// WithNameNormalizer returns a CacheOption that puts template names into a
+// canonical form with normalize, e.g. strings.ToLower for names taken from
+// case-insensitive sources such as URL slugs. The names of the schematic's
+// entries, their base templates and includes are normalized by New and
+// RestoreSchematic, and names passed to Get and every other method are
+// normalized on entry, so that requests for differently written names share a
+// cache entry, and logs and errors report the canonical name.
+//
+// normalize must be idempotent: a name may be normalized more than once, so
+// normalizing a canonical name must return it unchanged.
+//
+// New returns an error matching ErrInvalidSchematic if two entries' names
+// normalize to the same name.
+func WithNameNormalizer(normalize func(name string) string) CacheOption {
+	return func(d *Doppel) error {
+		if normalize == nil {
+			return invalidOption("WithNameNormalizer", "nil normalizer")
+		}
+		d.normalizeName = normalize
+		return nil
+	}
+}
+
 // WithRetryTimeouts causes cache entries in an error state as a result of
 // timeout or cancellation to be retried.
 func WithRetryTimeouts() CacheOption {
-	return func(d *Doppel) {
+	return func(d *Doppel) error {
 		d.retryTimeouts = true
+		return nil
+	}
+}
+
+// WithSortedFilepaths causes the Filepaths of every TemplateSchematic to be
+// sorted before use, including those supplied via RestoreSchematic, so that
+// templates are composed identically however their schematic was built. Order
+// matters when more than one file defines the same template name, since the
+// last file parsed wins; WithStrictDefinitions rejects such files instead.
+func WithSortedFilepaths() CacheOption {
+	return func(d *Doppel) error {
+		d.sortFilepaths = true
+		return nil
+	}
+}
+
+// WithStrictDefinitions causes parsing to fail with ErrDuplicateDefinition
+// when more than one file in a TemplateSchematic's Filepaths defines the same
+// template name. Without it, the last file to define a name silently wins.
+func WithStrictDefinitions() CacheOption {
+	return func(d *Doppel) error {
+		d.strictDefinitions = true
+		return nil
+	}
+}
+
+// WithReadTimeout returns a CacheOption that bounds the time taken to read each
+// template file from disk, independently of the request's context. A read
+// that exceeds the timeout fails with context.DeadlineExceeded and may be
+// retried according to WithRetryTimeouts. The timeout must not be negative;
+// zero disables it.
+func WithReadTimeout(timeout time.Duration) CacheOption {
+	return func(d *Doppel) error {
+		if timeout < 0 {
+			return invalidOption("WithReadTimeout", "negative timeout %v", timeout)
+		}
+		d.readTimeout = timeout
+		return nil
+	}
+}
+
+// WithTemplateNamer returns a CacheOption that determines the name each
+// template file is associated with when parsed. By default, files are named by
+// filepath.Base, as with template.ParseFiles, so files with the same base name
+// in different directories collide. A namer that returns, say, the path
+// relative to a template root avoids this. The namer must not be nil.
+func WithTemplateNamer(namer func(path string) string) CacheOption {
+	return func(d *Doppel) error {
+		if namer == nil {
+			return invalidOption("WithTemplateNamer", "nil namer")
+		}
+		d.templateName = namer
+		return nil
+	}
+}
+
+// WithFS returns a CacheOption that reads template files from fsys rather
+// than the local filesystem, e.g. from an embed.FS, or from an fstest.MapFS in
+// tests. Filepaths are then interpreted as paths within fsys, which are
+// slash-separated and unrooted. fsys must not be nil.
+func WithFS(fsys fs.FS) CacheOption {
+	return func(d *Doppel) error {
+		if fsys == nil {
+			return invalidOption("WithFS", "nil fs.FS")
+		}
+		d.open = func(path string) (io.ReadCloser, error) {
+			return fsys.Open(path)
+		}
+		return nil
+	}
+}
+
+// WithContextDataFunc returns a CacheOption that derives template data from
+// the request context in Execute and ExecuteStream, e.g. to make the current
+// user's locale available to every template.
+//
+// When the caller also passes explicit data, the explicit data takes
+// precedence. If both are of type map[string]interface{}, they are merged and
+// explicit keys win. Otherwise, non-nil explicit data is used as is and the
+// context data is discarded. fn must not be nil.
+func WithContextDataFunc(fn func(ctx context.Context) interface{}) CacheOption {
+	return func(d *Doppel) error {
+		if fn == nil {
+			return invalidOption("WithContextDataFunc", "nil func")
+		}
+		d.contextData = fn
+		return nil
+	}
+}
+
+// WithDefaultData returns a CacheOption that supplies default data when the
+// named template is executed by Execute and related methods, e.g. for fields
+// such as the site name that every execution needs. It may be given once for
+// each template.
+//
+// Default data is used as is when no other data is supplied. Otherwise, it and
+// the data passed to Execute, combined with any context data as described for
+// WithContextDataFunc, must both be of type map[string]interface{}: they are
+// merged, with the per-request keys winning. For other combinations of types,
+// execution fails with ErrIncompatibleData. A map passed as data is copied, so
+// later changes to it have no effect.
+func WithDefaultData(name string, data interface{}) CacheOption {
+	if m, ok := data.(map[string]interface{}); ok {
+		copied := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			copied[k] = v
+		}
+		data = copied
+	}
+	return func(d *Doppel) error {
+		if name == "" {
+			return invalidOption("WithDefaultData", "template name is empty")
+		}
+		if data == nil {
+			return invalidOption("WithDefaultData", "data for template %q is nil", name)
+		}
+		if _, ok := d.defaultData[name]; ok {
+			return invalidOption("WithDefaultData", "default data for template %q given more than once", name)
+		}
+		if d.defaultData == nil {
+			d.defaultData = make(map[string]interface{})
+		}
+		d.defaultData[name] = data
+		return nil
+	}
+}
+
+// WithDevMode causes every request to reparse its template from disk,
+// including each base template in its chain, so that changes to template files
+// are reflected immediately. Errors are never cached. WithDevMode is intended
+// for development only, e.g.
+//
+//	var opts []doppel.CacheOption
+//	if os.Getenv("ENV") == "development" {
+//		opts = append(opts, doppel.WithDevMode())
+//	}
+func WithDevMode() CacheOption {
+	return func(d *Doppel) error {
+		d.devMode = true
+		return nil
+	}
+}
+
+// The environments accepted by WithEnvironment.
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// WithEnvironment configures the Doppel for the named environment, bundling
+// the options suited to it. EnvDevelopment implies WithDevMode, so that every
+// request reparses its template and edits are visible immediately.
+// EnvProduction parses each template once and caches the result, undoing any
+// earlier WithDevMode or WithNoErrorCaching.
+//
+// Like every CacheOption, WithEnvironment may be overridden by options passed
+// after it. The environment is reported by Environment, and the resulting
+// behavior by DevModeEnabled.
+func WithEnvironment(env string) CacheOption {
+	return func(d *Doppel) error {
+		switch env {
+		case EnvDevelopment:
+			d.devMode = true
+		case EnvProduction:
+			d.devMode = false
+			d.noErrorCaching = false
+		default:
+			return invalidOption("WithEnvironment", "unknown environment %q", env)
+		}
+		d.environment = env
+		return nil
+	}
+}
+
+// WithLocalizer returns a CacheOption that provides the locale-specific
+// functions and files used by GetLocalized. The Localizer must not be nil.
+func WithLocalizer(l Localizer) CacheOption {
+	return func(d *Doppel) error {
+		if l == nil {
+			return invalidOption("WithLocalizer", "nil Localizer")
+		}
+		d.localizer = l
+		return nil
+	}
+}
+
+// WithRenderCache returns a CacheOption that enables caching of rendered output
+// by ExecuteCached. Output expires ttl after it is rendered, and at most
+// maxEntries outputs are retained, evicting the least recently used. A ttl or
+// maxEntries of zero disables the respective limit; neither may be negative.
+func WithRenderCache(ttl time.Duration, maxEntries int) CacheOption {
+	return func(d *Doppel) error {
+		if ttl < 0 {
+			return invalidOption("WithRenderCache", "negative ttl %v", ttl)
+		}
+		if maxEntries < 0 {
+			return invalidOption("WithRenderCache", "negative maxEntries %d", maxEntries)
+		}
+		d.renders = newRenderCache(ttl, maxEntries)
+		return nil
+	}
+}
+
+// WithEventHook returns a CacheOption that calls hook for each CacheEvent, a
+// lightweight alternative to full metrics.
+//
+// hook is called synchronously, both from the cache goroutine and from the
+// goroutines that parse and deliver templates. It must therefore be safe for
+// concurrent use and must not block: a slow hook delays every request to the
+// cache. Hooks that do significant work should hand events off to another
+// goroutine. hook must not be nil.
+func WithEventHook(hook func(ev CacheEvent)) CacheOption {
+	return func(d *Doppel) error {
+		if hook == nil {
+			return invalidOption("WithEventHook", "nil hook")
+		}
+		d.eventHook = hook
+		return nil
+	}
+}
+
+// WithPanicHandler returns a CacheOption that calls handler with the recovered
+// value if the cache goroutine panics. Whether or not a handler is supplied, a
+// panic is logged and shuts the cache down, so that requests fail with
+// ErrDoppelShutdown instead of hanging. handler is called on the cache
+// goroutine before shutdown and must not call the Doppel.
+func WithPanicHandler(handler func(recovered interface{})) CacheOption {
+	return func(d *Doppel) error {
+		if handler == nil {
+			return invalidOption("WithPanicHandler", "nil handler")
+		}
+		d.panicHandler = handler
+		return nil
+	}
+}
+
+// WithParseErrorTransform returns a CacheOption that passes each error
+// encountered while reading or parsing a template's files through transform
+// before it is cached, e.g. to redact filesystem paths from errors shown to end
+// users. Since the cached error is the transformed one, every request that
+// receives it, and ParseErrors, sees the result. Get continues to wrap it in a
+// RequestError.
+//
+// Cancellations and timeouts are not transformed, so that they are retried as
+// usual. If transform returns nil, the original error is cached. transform must
+// not be nil.
+func WithParseErrorTransform(transform func(error) error) CacheOption {
+	return func(d *Doppel) error {
+		if transform == nil {
+			return invalidOption("WithParseErrorTransform", "nil transform")
+		}
+		d.transformParseErr = transform
+		return nil
+	}
+}
+
+// WithClock returns a CacheOption that replaces the system clock used for
+// timeouts, request durations and timestamps. It is intended for tests that
+// exercise time-dependent behavior without sleeping. The Clock must not be
+// nil.
+func WithClock(c Clock) CacheOption {
+	return func(d *Doppel) error {
+		if c == nil {
+			return invalidOption("WithClock", "nil Clock")
+		}
+		d.clock = c
+		return nil
+	}
+}
+
+// WithRequestBuffer returns a CacheOption that allows up to n requests to queue
+// for the cache goroutine, smoothing bursts of concurrent Gets that would
+// otherwise each wait for the cache goroutine to receive them. Requests still
+// queued when the Doppel shuts down fail with ErrDoppelShutdown. n must not be
+// negative.
+func WithRequestBuffer(n int) CacheOption {
+	return func(d *Doppel) error {
+		if n < 0 {
+			return invalidOption("WithRequestBuffer", "negative buffer size %d", n)
+		}
+		d.requestBuffer = n
+		return nil
+	}
+}
+
+// WithExecuteTimeout bounds the time Execute and ExecuteCached spend executing
+// a template, e.g. if a function in its FuncMap hangs. Output is buffered and
+// discarded if execution times out, in which case ErrExecuteTimeout is
+// returned.
+//
+// Go's template execution can't be canceled, so the goroutine executing a
+// template that times out is abandoned, continuing to run until execution
+// completes. ExecuteStream is unaffected, since its output can't be buffered;
+// it is bounded by its context instead.
+//
+// The timeout must not be negative; zero disables it.
+func WithExecuteTimeout(timeout time.Duration) CacheOption {
+	return func(d *Doppel) error {
+		if timeout < 0 {
+			return invalidOption("WithExecuteTimeout", "negative timeout %v", timeout)
+		}
+		d.executeTimeout = timeout
+		return nil
+	}
+}
+
+// WithStreamingRender causes Render to stream output to the response as it is
+// produced, as for ExecuteStream, rather than buffering it. Streaming reduces
+// memory use and the time to first byte of large pages, but an execution error
+// can no longer be reported with an error status once output has been sent:
+// the response is cut short and the error logged. WithExecuteTimeout doesn't
+// apply to streamed renders.
+func WithStreamingRender() CacheOption {
+	return func(d *Doppel) error {
+		d.streamingRender = true
+		return nil
+	}
+}
+
+// WithEmptySchematic permits New and Initialize to accept a nil or empty
+// CacheSchematic, for callers that supply their templates later via
+// RestoreSchematic. Without it, an empty schematic is reported as
+// ErrEmptySchematic, since every Get would fail.
+func WithEmptySchematic() CacheOption {
+	return func(d *Doppel) error {
+		d.allowEmptySchematic = true
+		return nil
+	}
+}
+
+// WithNoErrorCaching causes templates that failed to parse to be parsed again
+// by the next request, rather than every subsequent request receiving the
+// original error, e.g. so that a file that is briefly unavailable during a
+// deploy doesn't break a template permanently. Requests for templates absent
+// from the schematic always fail with ErrSchematicNotFound.
+//
+// WithRetryTimeouts remains useful alongside WithNoErrorCaching: it retries a
+// timed out parse on behalf of requests that are already waiting for it, while
+// WithNoErrorCaching only affects requests made after the parse has failed.
+func WithNoErrorCaching() CacheOption {
+	return func(d *Doppel) error {
+		d.noErrorCaching = true
+		return nil
+	}
+}
+
+// WithMaxDepth limits the number of templates in a template's chain of base
+// templates, including the template itself, to n. Requests for templates with
+// longer chains fail with ErrMaxDepthExceeded, since deeply nested chains are
+// almost certainly a mistake. n must be positive. By default, chains are
+// unlimited.
+func WithMaxDepth(n int) CacheOption {
+	return func(d *Doppel) error {
+		if n < 1 {
+			return invalidOption("WithMaxDepth", "depth %d is not positive", n)
+		}
+		d.maxDepth = n
+		return nil
+	}
+}
+
+// WithSinglePassParsing causes a template whose base templates aren't cached
+// to be parsed together with its bases in a single pass, rather than by
+// requesting each base from the cache in turn, saving a round trip through the
+// cache for each level of the chain. The resulting template is identical.
+//
+// Bases parsed this way aren't cached in their own right, so a request for a
+// base, or for another template sharing it, parses it again. If any base is
+// already cached, the template is composed from it as usual. Single-pass
+// parsing therefore suits templates that are requested directly, rather than
+// shared bases.
+func WithSinglePassParsing() CacheOption {
+	return func(d *Doppel) error {
+		d.singlePass = true
+		return nil
+	}
+}
+
+// WithRenderCompression causes the render cache enabled by WithRenderCache to
+// store gzip-compressed output, reducing its memory use. WriteCompressed serves
+// the compressed output directly to clients that accept gzip; ExecuteCached,
+// RenderCached and clients that don't accept gzip receive decompressed output.
+func WithRenderCompression() CacheOption {
+	return func(d *Doppel) error {
+		d.compressRenders = true
+		return nil
+	}
+}
+
+// WithOverrides replaces entries of the schematic passed to New with copies of
+// the entries of the same name in overrides, adding any that are new. It suits
+// integration tests that need the production schematic with one or two entries
+// pointed at fixture files, e.g.
+//
+//	d, err := doppel.New(ctx, schematic, doppel.WithOverrides(doppel.CacheSchematic{
+//		"nav": {BaseTmplName: "base", Filepaths: []string{"testdata/nav.gohtml"}},
+//	}))
+//
+// New works from a copy of schematic, so the caller's schematic, and any Doppel
+// already built from it, are unaffected. The result must be acyclic, and the
+// base template of each override must exist; otherwise New returns an error
+// matching ErrInvalidOption.
+func WithOverrides(overrides CacheSchematic) CacheOption {
+	return func(d *Doppel) error {
+		for name, ts := range overrides {
+			d.schematic[name] = ts.Clone()
+		}
+		if cyclic, err := IsCyclic(d.schematic); cyclic {
+			return invalidOption("WithOverrides", "%v", err)
+		}
+		for _, name := range overrides.names() {
+			ts := overrides[name]
+			if ts != nil && ts.BaseTmplName != "" && d.schematic[ts.BaseTmplName] == nil {
+				return invalidOption("WithOverrides", "base template %q of %q not found", ts.BaseTmplName, name)
+			}
+		}
+		return nil
+	}
+}
+
+// WithPartialGroup registers a named group of files that TemplateSchematics
+// may reference in their Filepaths as "@" followed by the group's name, e.g.
+// "@partials". Each reference is replaced by the group's files when the
+// schematic is validated by New or RestoreSchematic, so the expanded paths
+// appear in snapshots. Unlike Includes, groups don't add edges to the
+// schematic's graph.
+//
+// The group name must not be empty, must not already be registered, and paths
+// must not be empty.
+func WithPartialGroup(name string, paths []string) CacheOption {
+	return func(d *Doppel) error {
+		if name == "" {
+			return invalidOption("WithPartialGroup", "empty group name")
+		}
+		if _, ok := d.partialGroups[name]; ok {
+			return invalidOption("WithPartialGroup", "group %q registered more than once", name)
+		}
+		if len(paths) == 0 {
+			return invalidOption("WithPartialGroup", "group %q has no files", name)
+		}
+
+		if d.partialGroups == nil {
+			d.partialGroups = make(map[string][]string)
+		}
+		d.partialGroups[name] = append([]string(nil), paths...)
+		return nil
+	}
+}
+
+// WithFuncs makes funcs available to every template when it is parsed. Calling
+// WithFuncs more than once merges the function maps, with later functions
+// replacing earlier ones of the same name. Functions whose behaviour depends on
+// the request can be registered here as placeholders and replaced per call via
+// GetWithFuncs.
+func WithFuncs(funcs template.FuncMap) CacheOption {
+	return func(d *Doppel) error {
+		if len(funcs) == 0 {
+			return invalidOption("WithFuncs", "no functions")
+		}
+
+		if d.funcs == nil {
+			d.funcs = make(template.FuncMap, len(funcs))
+		}
+		for name, fn := range funcs {
+			d.funcs[name] = fn
+		}
+		return nil
+	}
+}
+
+// WithSmokeTest causes New to parse every template in the schematic and
+// execute it, discarding the output, with the probe data registered for its
+// name in data, or nil if there is none. New fails with an error matching
+// ErrSmokeTestFailed that lists every template that fails to parse or
+// execute, turning errors that would otherwise surface when a template is
+// first executed, such as calls to missing methods, into startup failures.
+//
+// Templates parsed by the smoke test aren't cached. Executions are bounded by
+// WithExecuteTimeout, if set.
+func WithSmokeTest(data map[string]interface{}) CacheOption {
+	return func(d *Doppel) error {
+		d.smokeTest = true
+		d.smokeData = make(map[string]interface{}, len(data))
+		for name, probe := range data {
+			d.smokeData[name] = probe
+		}
+		return nil
+	}
+}
+
+// WithSmokeTestSkipUnprobed causes the smoke test enabled by WithSmokeTest to
+// skip templates without probe data, such as layouts that can't be executed
+// alone, rather than executing them with nil data.
+func WithSmokeTestSkipUnprobed() CacheOption {
+	return func(d *Doppel) error {
+		d.smokeSkipUnprobed = true
+		return nil
+	}
+}
+
+// WithLogSampling causes only one in every n of the high-volume log messages
+// emitted for each request, such as a request being received or a template
+// delivered, to be logged. Parse results, errors and evictions are always
+// logged. Sampling affects logging alone: statistics and event hooks still
+// observe every request.
+//
+// n must be at least 1; a rate of 1 logs every message.
+func WithLogSampling(n int) CacheOption {
+	return func(d *Doppel) error {
+		if n < 1 {
+			return invalidOption("WithLogSampling", "sampling rate %d is less than 1", n)
+		}
+		d.logSampler = &logSampler{n: uint64(n)}
+		return nil
+	}
+}
+
+// WithQueueLogging causes a message to be logged as each request is sent to
+// the cache, and another as the cache begins serving it, reporting how long
+// the request waited in the queue. Both messages carry a sequence number that
+// identifies the request. Queue messages are not subject to WithLogSampling.
+func WithQueueLogging() CacheOption {
+	return func(d *Doppel) error {
+		d.logQueue = true
+		return nil
+	}
+}
+
+// WithBackend selects how requests reach the cache. BackendLocked serves
+// requests for parsed templates without visiting the cache goroutine, which
+// suits read-heavy workloads with many concurrent callers. Requests served
+// this way don't appear in queue logs, and signal the heartbeat via the cache
+// goroutine, so that it may coalesce several hits into a single signal.
+func WithBackend(b Backend) CacheOption {
+	return func(d *Doppel) error {
+		if b != BackendChannel && b != BackendLocked {
+			return invalidOption("WithBackend", "unknown backend %d", int(b))
+		}
+		d.backend = b
+		return nil
+	}
+}
+
+// WithLatencyLogging causes a summary line to be logged as each request
+// completes, breaking its latency down into the time spent queued for the
+// cache goroutine, waiting for the template to be parsed, and cloning it.
+// RequestErrors returned by Get carry the same breakdown in their Latency
+// field.
+func WithLatencyLogging() CacheOption {
+	return func(d *Doppel) error {
+		d.latencyLogging = true
+		return nil
+	}
+}
+
+// WithVerboseErrors previously controlled whether errors returned on the
+// request path captured a stack trace.
+//
+// Deprecated: errors no longer capture stack traces, so WithVerboseErrors has
+// no effect.
+func WithVerboseErrors(verbose bool) CacheOption {
+	return func(*Doppel) error {
+		return nil
+	}
+}
+
+// WithUnsafeAllowConflicts disables the check New performs for combinations of
+// options that interact badly, such as WithDevMode and WithRenderCache. It is
+// intended for callers who understand the consequences of the combination.
+func WithUnsafeAllowConflicts() CacheOption {
+	return func(d *Doppel) error {
+		d.allowConflicts = true
+		return nil
 	}
 }
 
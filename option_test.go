@@ -6,10 +6,25 @@ package doppel
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -50,6 +65,140 @@ func TestWithLogger(t *testing.T) {
 			t.Error("failed to log operation, got empty string")
 		}
 	})
+
+	t.Run("logs template names containing formatting verbs verbatim", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		l := &testLogger{out: &bytes.Buffer{}}
+		d, err := New(ctx, schematic, WithLogger(l))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Get(context.Background(), "100%s")
+
+		gotLogs := l.String()
+		if !strings.Contains(gotLogs, fmt.Sprintf(logMissingSchematic, "100%s")) {
+			t.Errorf("template name was not logged verbatim:\n%s", gotLogs)
+		}
+		if strings.Contains(gotLogs, "%!") {
+			t.Errorf("log output contains formatting errors:\n%s", gotLogs)
+		}
+	})
+}
+
+func TestWithStdLogger(t *testing.T) {
+	t.Run("logs cache operations to the *log.Logger provided", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var buf syncBuffer
+		d, err := New(ctx, schematic, WithStdLogger(log.New(&buf, "", 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Get(context.Background(), "withBody1")
+
+		want := fmt.Sprintf(logParsingTemplate+"\n", "withBody1")
+		if gotLogs := buf.String(); !strings.Contains(gotLogs, want) {
+			t.Errorf("got logs %q, want to contain %q", gotLogs, want)
+		}
+	})
+}
+
+func TestWithWriterLogger(t *testing.T) {
+	t.Run("logs prefixed lines to the writer provided", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var buf syncBuffer
+		d, err := New(ctx, schematic, WithWriterLogger(&buf, "doppel: "))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Get(context.Background(), "withBody1")
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		for _, line := range lines {
+			if !strings.HasPrefix(line, "doppel: ") {
+				t.Errorf("line %q is missing prefix", line)
+			}
+		}
+	})
+}
+
+func TestInvalidOptions(t *testing.T) {
+	testCases := []struct {
+		option string
+		opt    CacheOption
+	}{
+		{"WithGlobalTimeout", WithGlobalTimeout(-5)},
+		{"WithLogger", WithLogger(nil)},
+		{"WithStdLogger", WithStdLogger(nil)},
+		{"WithWriterLogger", WithWriterLogger(nil, "")},
+		{"WithReadTimeout", WithReadTimeout(-time.Second)},
+		{"WithTemplateNamer", WithTemplateNamer(nil)},
+		{"WithRenderCache", WithRenderCache(-time.Second, 1)},
+		{"WithRenderCache", WithRenderCache(time.Second, -1)},
+		{"WithClock", WithClock(nil)},
+		{"WithRequestBuffer", WithRequestBuffer(-1)},
+		{"WithExecuteTimeout", WithExecuteTimeout(-time.Second)},
+		{"WithSlowParseThreshold", WithSlowParseThreshold(-time.Second)},
+		{"WithNameNormalizer", WithNameNormalizer(nil)},
+		{"WithMaxDepth", WithMaxDepth(0)},
+		{"WithPartialGroup", WithPartialGroup("", []string{navpath})},
+		{"WithPartialGroup", WithPartialGroup("nav", nil)},
+		{"WithFuncs", WithFuncs(nil)},
+		{"WithLogSampling", WithLogSampling(0)},
+		{"WithFS", WithFS(nil)},
+		{"WithEnvironment", WithEnvironment("staging")},
+		{"WithPanicHandler", WithPanicHandler(nil)},
+		{"WithEventHook", WithEventHook(nil)},
+		{"WithLocalizer", WithLocalizer(nil)},
+		{"WithContextDataFunc", WithContextDataFunc(nil)},
+		{"WithParseErrorTransform", WithParseErrorTransform(nil)},
+		{"WithDefaultData", WithDefaultData("", map[string]interface{}{})},
+		{"WithDefaultData", WithDefaultData("base", nil)},
+		{"WithTemplateTimeouts", WithTemplateTimeouts(map[string]time.Duration{"base": -time.Second})},
+		{"WithOverrides", WithOverrides(CacheSchematic{"base": {BaseTmplName: "withBody1", Filepaths: []string{basepath}}})},
+		{"WithOverrides", WithOverrides(CacheSchematic{"withBody1": {BaseTmplName: "unknown", Filepaths: []string{body1Path}}})},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.option, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d, err := New(ctx, schematic, tc.opt)
+			if !errors.Is(err, ErrInvalidOption) {
+				t.Fatalf("got error %v, want ErrInvalidOption", err)
+			}
+			if !strings.Contains(err.Error(), tc.option) {
+				t.Errorf("error %q does not name the option %s", err, tc.option)
+			}
+			if d != nil {
+				t.Errorf("got *Doppel %+v, want nil", d)
+			}
+		})
+	}
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.String()
 }
 
 func TestWithGlobalTimeout(t *testing.T) {
@@ -57,14 +206,35 @@ func TestWithGlobalTimeout(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		globalTimeout := 1 * time.Nanosecond
-		d, err := New(ctx, schematic, WithGlobalTimeout(globalTimeout))
+		release := make(chan struct{})
+		defer close(release)
+		hungOpen := OptionFunc(func(d *Doppel) {
+			d.open = func(string) (io.ReadCloser, error) {
+				return &slowReader{release}, nil
+			}
+		})
+
+		clk := newFakeClock()
+		d, err := New(ctx, schematic, WithClock(clk), WithGlobalTimeout(time.Hour), hungOpen)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		_, err = d.Get(context.Background(), "base")
-		if !errors.Is(err, context.DeadlineExceeded) {
+		errStream := make(chan error)
+		go func() {
+			_, err := d.Get(context.Background(), "base")
+			errStream <- err
+		}()
+
+		waitFor(t, func() bool { return clk.Timers() > 0 })
+		select {
+		case err := <-errStream:
+			t.Fatalf("Get returned before timeout: %v", err)
+		default:
+		}
+
+		clk.Advance(time.Hour)
+		if err := <-errStream; !errors.Is(err, context.DeadlineExceeded) {
 			t.Errorf("want context.DeadlineExceeded, got: %v", err)
 		}
 	})
@@ -99,3 +269,1266 @@ func TestWithGlobalTimeout(t *testing.T) {
 		}
 	})
 }
+
+func TestWithTemplateTimeouts(t *testing.T) {
+	// timesOutAfter checks that a Get for base, whose parse never completes,
+	// fails with context.DeadlineExceeded once the clock advances by elapsed,
+	// but not before.
+	timesOutAfter := func(t *testing.T, elapsed time.Duration, opts ...CacheOption) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		release := make(chan struct{})
+		defer close(release)
+		hungOpen := OptionFunc(func(d *Doppel) {
+			d.open = func(string) (io.ReadCloser, error) {
+				return &slowReader{release}, nil
+			}
+		})
+
+		clk := newFakeClock()
+		d, err := New(ctx, schematic, append(opts, WithClock(clk), hungOpen)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errStream := make(chan error)
+		go func() {
+			_, err := d.Get(context.Background(), "base")
+			errStream <- err
+		}()
+
+		waitFor(t, func() bool { return clk.Timers() > 0 })
+		clk.Advance(elapsed - time.Nanosecond)
+		select {
+		case err := <-errStream:
+			t.Fatalf("Get returned before %v: %v", elapsed, err)
+		case <-time.After(10 * time.Millisecond): // allow a premature timeout to propagate
+		}
+
+		clk.Advance(time.Nanosecond)
+		if err := <-errStream; !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("want context.DeadlineExceeded, got: %v", err)
+		}
+	}
+
+	t.Run("template timeout applies when tighter than global timeout", func(t *testing.T) {
+		timesOutAfter(t, time.Minute,
+			WithGlobalTimeout(time.Hour),
+			WithTemplateTimeouts(map[string]time.Duration{"base": time.Minute}))
+	})
+
+	t.Run("global timeout applies when tighter than template timeout", func(t *testing.T) {
+		timesOutAfter(t, time.Minute,
+			WithGlobalTimeout(time.Minute),
+			WithTemplateTimeouts(map[string]time.Duration{"base": time.Hour}))
+	})
+
+	t.Run("template timeout applies without global timeout", func(t *testing.T) {
+		timesOutAfter(t, time.Minute,
+			WithTemplateTimeouts(map[string]time.Duration{"base": time.Minute}))
+	})
+
+	t.Run("zero template timeout defers to global timeout", func(t *testing.T) {
+		timesOutAfter(t, time.Minute,
+			WithGlobalTimeout(time.Minute),
+			WithTemplateTimeouts(map[string]time.Duration{"base": 0}))
+	})
+
+	t.Run("templates absent from the map use the global timeout", func(t *testing.T) {
+		timesOutAfter(t, time.Minute,
+			WithGlobalTimeout(time.Minute),
+			WithTemplateTimeouts(map[string]time.Duration{"withBody1": time.Second}))
+	})
+
+	t.Run("changes to the map after New are ignored", func(t *testing.T) {
+		timeouts := map[string]time.Duration{"base": time.Hour}
+		opt := WithTemplateTimeouts(timeouts)
+		timeouts["base"] = time.Second
+		timesOutAfter(t, time.Hour, opt)
+	})
+}
+
+func TestWithSortedFilepaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	for _, name := range []string{"a", "b"} {
+		path := filepath.Join(dir, name+".gohtml")
+		if err := ioutil.WriteFile(path, []byte(`{{define "body"}}`+name+`{{end}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	orders := [][]string{{paths[0], paths[1]}, {paths[1], paths[0]}}
+	layout := filepath.Join(dir, "layout.gohtml")
+	if err := ioutil.WriteFile(layout, []byte(`{{template "body"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newSchematic := func(filepaths []string) CacheSchematic {
+		return CacheSchematic{
+			"layout": {Filepaths: []string{layout}},
+			"page":   {BaseTmplName: "layout", Filepaths: filepaths},
+		}
+	}
+
+	render := func(t *testing.T, filepaths []string, opts ...CacheOption) string {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, newSchematic(filepaths), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := d.Execute(context.Background(), &buf, "page", nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	t.Run("output is stable regardless of order", func(t *testing.T) {
+		for _, order := range orders {
+			if got := render(t, append([]string(nil), order...), WithSortedFilepaths()); got != "b" {
+				t.Errorf("order %v: got %q, want %q", order, got, "b")
+			}
+		}
+	})
+
+	t.Run("order decides the output by default", func(t *testing.T) {
+		if a, b := render(t, orders[1]), render(t, orders[0]); a == b {
+			t.Errorf("got %q for both orders, want the last file to win", a)
+		}
+	})
+
+	t.Run("restored schematics are sorted", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, newSchematic(orders[0]), WithSortedFilepaths())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.RestoreSchematic(context.Background(), newSchematic(orders[1])); err != nil {
+			t.Fatal(err)
+		}
+		ts, _ := d.SchematicFor("page")
+		if !reflect.DeepEqual(ts.Filepaths, paths) {
+			t.Errorf("got Filepaths %v, want %v", ts.Filepaths, paths)
+		}
+	})
+}
+
+func TestWithStrictDefinitions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	overridePath := filepath.Join(dir, "override.gohtml")
+	err = ioutil.WriteFile(overridePath, []byte(`{{define "body"}}override{{end}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testSchematic := schematic.Clone()
+	testSchematic["override"] = &TemplateSchematic{BaseTmplName: "commonNav", Filepaths: []string{body1Path, overridePath}}
+
+	t.Run("Get returns ErrDuplicateDefinition when files redefine a template", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, testSchematic, WithStrictDefinitions())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = d.Get(context.Background(), "override")
+		if err == nil || !strings.Contains(err.Error(), ErrDuplicateDefinition.Error()) {
+			t.Errorf("want ErrDuplicateDefinition, got: %v", err)
+		}
+
+		if _, err = d.Get(context.Background(), "withBody1"); err != nil {
+			t.Errorf("got error for template without duplicates: %v", err)
+		}
+	})
+
+	t.Run("each file is read once", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var mu sync.Mutex
+		opened := make(map[string]int)
+		countingOpen := OptionFunc(func(d *Doppel) {
+			d.open = func(path string) (io.ReadCloser, error) {
+				mu.Lock()
+				opened[path]++
+				mu.Unlock()
+				return os.Open(path)
+			}
+		})
+		for _, singlePass := range []bool{false, true} {
+			opts := []CacheOption{WithStrictDefinitions(), countingOpen}
+			if singlePass {
+				opts = append(opts, WithSinglePassParsing())
+			}
+			d, err := New(ctx, testSchematic, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for path, n := range opened {
+			if n != 2 {
+				t.Errorf("%s: opened %d times across two Doppels, want 2", path, n)
+			}
+		}
+	})
+
+	t.Run("the last definition wins by default", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, testSchematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = d.Get(context.Background(), "override"); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// slowReader blocks each Read until release is closed.
+type slowReader struct {
+	release <-chan struct{}
+}
+
+func (sr *slowReader) Read(p []byte) (int, error) {
+	<-sr.release
+	return 0, io.EOF
+}
+
+func (sr *slowReader) Close() error {
+	return nil
+}
+
+func TestWithReadTimeout(t *testing.T) {
+	t.Run("Get returns context.DeadlineExceeded when a read hangs", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		release := make(chan struct{})
+		defer close(release)
+		slowOpen := OptionFunc(func(d *Doppel) {
+			d.open = func(string) (io.ReadCloser, error) {
+				return &slowReader{release}, nil
+			}
+		})
+
+		d, err := New(ctx, schematic, WithReadTimeout(10*time.Millisecond), slowOpen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errStream := make(chan error)
+		go func() {
+			_, err := d.Get(context.Background(), "withBody1")
+			errStream <- err
+		}()
+
+		select {
+		case err := <-errStream:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("want context.DeadlineExceeded, got: %v", err)
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatal("Get blocked on hung read")
+		}
+	})
+
+	t.Run("reads that complete within the timeout succeed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic, WithReadTimeout(1*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("the timeout applies to each file rather than the whole parse", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		const readTime = 30 * time.Millisecond
+		delayedOpen := OptionFunc(func(d *Doppel) {
+			d.open = func(path string) (io.ReadCloser, error) {
+				time.Sleep(readTime)
+				return os.Open(path)
+			}
+		})
+		cs := CacheSchematic{
+			"multi": {Filepaths: []string{basepath, navpath, body1Path}},
+		}
+		d, err := New(ctx, cs, WithReadTimeout(2*readTime), delayedOpen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := d.Get(context.Background(), "multi"); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestWithSlowParseThreshold(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		threshold time.Duration
+		wantSlow  bool
+	}{
+		{"reports parses exceeding the threshold", time.Nanosecond, true},
+		{"ignores parses within the threshold", time.Hour, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			log := &testLogger{out: &bytes.Buffer{}}
+			rec := &eventRecorder{}
+			d, err := New(ctx, schematic, WithLogger(log), WithEventHook(rec.record), WithSlowParseThreshold(tc.threshold))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.Get(context.Background(), "base"); err != nil {
+				t.Fatal(err)
+			}
+
+			if slow := rec.count(EventSlowParse, "base") == 1; slow != tc.wantSlow {
+				t.Errorf("got slow parse event %t, want %t", slow, tc.wantSlow)
+			}
+			if logged := strings.Contains(log.String(), "exceeding the slow parse threshold"); logged != tc.wantSlow {
+				t.Errorf("got slow parse logged %t, want %t", logged, tc.wantSlow)
+			}
+		})
+	}
+}
+
+func TestWithTemplateNamer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a/index.gohtml": `A{{template "b/index.gohtml"}}`,
+		"b/index.gohtml": `B`,
+	}
+	var paths []string
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	namer := func(path string) string {
+		rel, _ := filepath.Rel(dir, path)
+		return filepath.ToSlash(rel)
+	}
+	d, err := New(ctx, CacheSchematic{"index": {Filepaths: paths}}, WithTemplateNamer(namer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := d.Get(context.Background(), "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		if tmpl.Lookup(name) == nil {
+			t.Errorf("template %q not found", name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "AB"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+}
+
+func TestWithDevMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	basePath := filepath.Join(dir, "base.gohtml")
+	pagePath := filepath.Join(dir, "page.gohtml")
+	write := func(path, src string) {
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	execute := func(tmpl *template.Template) string {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	devSchematic := CacheSchematic{
+		"base": {Filepaths: []string{basePath}},
+		"page": {BaseTmplName: "base", Filepaths: []string{pagePath}},
+	}
+
+	t.Run("reflects changes to base templates between requests", func(t *testing.T) {
+		write(basePath, `v1 {{template "content"}}`)
+		write(pagePath, `{{define "content"}}page{{end}}`)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, devSchematic, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tmpl, err := d.Get(context.Background(), "page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := execute(tmpl); got != "v1 page" {
+			t.Fatalf("got %q, want %q", got, "v1 page")
+		}
+
+		write(basePath, `v2 {{template "content"}}`)
+		tmpl, err = d.Get(context.Background(), "page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := execute(tmpl); got != "v2 page" {
+			t.Errorf("got %q, want %q", got, "v2 page")
+		}
+	})
+
+	t.Run("does not cache errors", func(t *testing.T) {
+		os.Remove(pagePath)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, devSchematic, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := d.Get(context.Background(), "page"); err == nil {
+			t.Fatal("Get succeeded with missing file")
+		}
+
+		write(pagePath, `{{define "content"}}page{{end}}`)
+		if _, err := d.Get(context.Background(), "page"); err != nil {
+			t.Errorf("error was cached: %v", err)
+		}
+	})
+}
+
+func TestWithRequestBuffer(t *testing.T) {
+	t.Run("serves concurrent requests", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic, WithRequestBuffer(8))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("Gets return promptly when the cache shuts down with requests queued", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		d, err := New(ctx, schematic, WithRequestBuffer(8))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		const count = 50
+		errStream := make(chan error, count)
+		for i := 0; i < count; i++ {
+			go func() {
+				_, err := d.Get(context.Background(), "withBody1")
+				errStream <- err
+			}()
+		}
+		cancel()
+
+		timeout := time.After(1 * time.Second)
+		for i := 0; i < count; i++ {
+			select {
+			case err := <-errStream:
+				if err != nil && !errors.Is(err, ErrDoppelShutdown) {
+					t.Errorf("got error %v, want nil or ErrDoppelShutdown", err)
+				}
+			case <-timeout:
+				t.Fatalf("%d Gets blocked after shutdown", count-i)
+			}
+		}
+	})
+}
+
+func TestWithNoErrorCaching(t *testing.T) {
+	t.Run("reparses templates that failed to parse", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "doppel")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "deployed.gohtml")
+
+		for _, opts := range [][]CacheOption{
+			{WithNoErrorCaching()},
+			{WithNoErrorCaching(), WithRetryTimeouts()},
+		} {
+			os.Remove(path)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d, err := New(ctx, CacheSchematic{"deployed": {Filepaths: []string{path}}}, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := d.Get(context.Background(), "deployed"); err == nil {
+				t.Fatal("got nil error for missing file")
+			}
+			if err := ioutil.WriteFile(path, []byte("deployed"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.Get(context.Background(), "deployed"); err != nil {
+				t.Errorf("error was cached: %v", err)
+			}
+		}
+	})
+
+	t.Run("caches ErrSchematicNotFound", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		rec := &eventRecorder{}
+		d, err := New(ctx, schematic, WithNoErrorCaching(), WithEventHook(rec.record))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if _, err := d.Get(context.Background(), "missing"); !errors.Is(err, ErrSchematicNotFound) {
+				t.Fatalf("got error %v, want ErrSchematicNotFound", err)
+			}
+		}
+		if got := rec.count(EventMiss, "missing"); got != 1 {
+			t.Errorf("got %d misses, want 1", got)
+		}
+	})
+}
+
+// linearChain returns a CacheSchematic describing a chain of length templates,
+// named "0" to "<length-1>", where each template's base is its predecessor.
+func linearChain(length int) CacheSchematic {
+	cs := CacheSchematic{"0": {Filepaths: []string{basepath}}}
+	for i := 1; i < length; i++ {
+		cs[strconv.Itoa(i)] = &TemplateSchematic{BaseTmplName: strconv.Itoa(i - 1), Filepaths: []string{body1Path}}
+	}
+	return cs
+}
+
+func TestWithMaxDepth(t *testing.T) {
+	const maxDepth = 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, linearChain(maxDepth+1), WithMaxDepth(maxDepth))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("serves chains within the limit", func(t *testing.T) {
+		if _, err := d.Get(context.Background(), strconv.Itoa(maxDepth-1)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rejects chains beyond the limit", func(t *testing.T) {
+		_, err := d.Get(context.Background(), strconv.Itoa(maxDepth))
+		if !errors.Is(err, ErrMaxDepthExceeded) {
+			t.Errorf("got error %v, want ErrMaxDepthExceeded", err)
+		}
+	})
+}
+
+// definedNames returns the sorted names of the templates associated with tmpl.
+func definedNames(tmpl *template.Template) []string {
+	var names []string
+	for _, t := range tmpl.Templates() {
+		names = append(names, t.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestWithSinglePassParsing(t *testing.T) {
+	t.Run("produces templates identical to incremental parsing", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		incremental, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		singlePass, err := New(ctx, schematic, WithSinglePassParsing())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name := range schematic {
+			want, err := incremental.Get(context.Background(), name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := singlePass.Get(context.Background(), name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Name() != want.Name() {
+				t.Errorf("%s: got root template %q, want %q", name, got.Name(), want.Name())
+			}
+			if gotDefs, wantDefs := definedNames(got), definedNames(want); fmt.Sprint(gotDefs) != fmt.Sprint(wantDefs) {
+				t.Errorf("%s: got templates %v, want %v", name, gotDefs, wantDefs)
+			}
+			// Templates that leave blocks for their dependents to define fail to
+			// execute, and must do so identically.
+			var gotOut, wantOut bytes.Buffer
+			wantErr := want.Execute(&wantOut, nil)
+			gotErr := got.Execute(&gotOut, nil)
+			if fmt.Sprint(gotErr) != fmt.Sprint(wantErr) {
+				t.Errorf("%s: got execution error %v, want %v", name, gotErr, wantErr)
+			}
+			if !bytes.Equal(gotOut.Bytes(), wantOut.Bytes()) {
+				t.Errorf("%s: got output\n%s\nwant\n%s", name, gotOut.String(), wantOut.String())
+			}
+		}
+	})
+
+	cachedNames := func(t *testing.T, d *Doppel) []string {
+		t.Helper()
+		snap, err := d.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, es := range snap.Entries {
+			names = append(names, es.Name)
+		}
+		return names
+	}
+
+	t.Run("doesn't cache bases parsed in the same pass", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic, WithSinglePassParsing())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := cachedNames(t, d); len(got) != 1 || got[0] != "withBody1" {
+			t.Errorf("got cached entries %v, want [withBody1]", got)
+		}
+	})
+
+	t.Run("composes templates from cached bases", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic, WithSinglePassParsing())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"base", "withBody1"} {
+			if _, err := d.Get(context.Background(), name); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		want := []string{"base", "commonNav", "withBody1"}
+		if got := cachedNames(t, d); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("got cached entries %v, want %v", got, want)
+		}
+	})
+}
+
+func TestWithPartialGroup(t *testing.T) {
+	grouped := schematic.Clone()
+	grouped["withBody1"].Filepaths = []string{"@nav", body1Path}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, grouped, WithPartialGroup("nav", []string{navpath}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("references are expanded in place", func(t *testing.T) {
+		ts, ok := d.SchematicFor("withBody1")
+		if !ok {
+			t.Fatal("withBody1 not found")
+		}
+		if want := []string{navpath, body1Path}; !reflect.DeepEqual(ts.Filepaths, want) {
+			t.Errorf("got Filepaths %v, want %v", ts.Filepaths, want)
+		}
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+
+		snap, err := d.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, es := range snap.Entries {
+			if es.Name == "withBody1" && !reflect.DeepEqual(es.Filepaths, []string{navpath, body1Path}) {
+				t.Errorf("got snapshot Filepaths %v, want expanded paths", es.Filepaths)
+			}
+		}
+	})
+
+	t.Run("RestoreSchematic expands references", func(t *testing.T) {
+		restored := schematic.Clone()
+		restored["withBody2"].Filepaths = []string{"@nav", body2Path}
+		if err := d.RestoreSchematic(context.Background(), restored); err != nil {
+			t.Fatal(err)
+		}
+		ts, _ := d.SchematicFor("withBody2")
+		if want := []string{navpath, body2Path}; !reflect.DeepEqual(ts.Filepaths, want) {
+			t.Errorf("got Filepaths %v, want %v", ts.Filepaths, want)
+		}
+		if restored["withBody2"].Filepaths[0] != "@nav" {
+			t.Error("RestoreSchematic modified the caller's schematic")
+		}
+	})
+
+	t.Run("unknown groups are rejected", func(t *testing.T) {
+		unknown := schematic.Clone()
+		unknown["withBody2"].Filepaths = []string{"@missing"}
+
+		_, err := New(ctx, unknown, WithPartialGroup("nav", []string{navpath}))
+		if !errors.Is(err, ErrUnknownPartialGroup) {
+			t.Fatalf("got error %v, want ErrUnknownPartialGroup", err)
+		}
+		for _, name := range []string{`"withBody2"`, `"missing"`} {
+			if !strings.Contains(err.Error(), name) {
+				t.Errorf("error %q does not name %s", err, name)
+			}
+		}
+
+		if err := d.RestoreSchematic(context.Background(), unknown); !errors.Is(err, ErrUnknownPartialGroup) {
+			t.Errorf("RestoreSchematic: got error %v, want ErrUnknownPartialGroup", err)
+		}
+	})
+
+	t.Run("groups can't be registered twice", func(t *testing.T) {
+		_, err := New(ctx, schematic, WithPartialGroup("nav", []string{navpath}), WithPartialGroup("nav", []string{body1Path}))
+		if !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("got error %v, want ErrInvalidOption", err)
+		}
+	})
+}
+
+func TestConfigAccessors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.GlobalTimeout(); got != 0 {
+		t.Errorf("default: got GlobalTimeout %v, want 0", got)
+	}
+	if d.RetryTimeoutsEnabled() {
+		t.Error("default: got RetryTimeoutsEnabled true, want false")
+	}
+
+	d, err = New(ctx, schematic, WithGlobalTimeout(time.Second), WithRetryTimeouts())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read concurrently with requests, to be checked by the race detector.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+				t.Error(err)
+			}
+			if got := d.GlobalTimeout(); got != time.Second {
+				t.Errorf("got GlobalTimeout %v, want %v", got, time.Second)
+			}
+			if !d.RetryTimeoutsEnabled() {
+				t.Error("got RetryTimeoutsEnabled false, want true")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWithEnvironment(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		opts        []CacheOption
+		wantEnv     string
+		wantDevMode bool
+	}{
+		{"default", nil, "", false},
+		{"development", []CacheOption{WithEnvironment(EnvDevelopment)}, EnvDevelopment, true},
+		{"production", []CacheOption{WithEnvironment(EnvProduction)}, EnvProduction, false},
+		{"production undoes earlier dev mode", []CacheOption{WithDevMode(), WithEnvironment(EnvProduction)}, EnvProduction, false},
+		{"later options override", []CacheOption{WithEnvironment(EnvProduction), WithDevMode()}, EnvProduction, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d, err := New(ctx, schematic, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := d.Environment(); got != tc.wantEnv {
+				t.Errorf("got Environment %q, want %q", got, tc.wantEnv)
+			}
+			if got := d.DevModeEnabled(); got != tc.wantDevMode {
+				t.Errorf("got DevModeEnabled %t, want %t", got, tc.wantDevMode)
+			}
+		})
+	}
+}
+
+func TestWithParseErrorTransform(t *testing.T) {
+	const missing = "/secret/path/missing.gohtml"
+	errRedacted := errors.New("template file unavailable")
+	testSchematic := schematic.Clone()
+	testSchematic["error"] = &TemplateSchematic{Filepaths: []string{missing}}
+
+	t.Run("caches the transformed error", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var calls int
+		transform := func(err error) error {
+			calls++
+			return errRedacted
+		}
+		d, err := New(ctx, testSchematic, WithParseErrorTransform(transform))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			_, err := d.Get(context.Background(), "error")
+			if !errors.Is(err, errRedacted) {
+				t.Fatalf("want errRedacted, got: %v", err)
+			}
+			if strings.Contains(err.Error(), missing) {
+				t.Errorf("error %q contains redacted path", err)
+			}
+			var reqErr RequestError
+			if !errors.As(err, &reqErr) || reqErr.Target != "error" {
+				t.Errorf("want RequestError for \"error\", got: %v", err)
+			}
+		}
+		if calls != 1 {
+			t.Errorf("transform called %d times, want 1", calls)
+		}
+
+		errs, err := d.ParseErrors(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !errors.Is(errs["error"], errRedacted) {
+			t.Errorf("want cached errRedacted, got: %v", errs["error"])
+		}
+	})
+
+	t.Run("caches the original error if transform returns nil", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, testSchematic, WithParseErrorTransform(func(error) error { return nil }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Get(context.Background(), "error"); err == nil || !strings.Contains(err.Error(), missing) {
+			t.Errorf("want original error, got: %v", err)
+		}
+	})
+}
+
+func TestWithPanicHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	recovered := make(chan interface{}, 1)
+	logger := &testLogger{out: &bytes.Buffer{}}
+	d, err := New(ctx, schematic, WithLogger(logger), WithPanicHandler(func(r interface{}) {
+		recovered <- r
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.do(context.Background(), func(map[string]*cacheEntry) {
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-recovered:
+		if r != "boom" {
+			t.Errorf("got recovered value %v, want %q", r, "boom")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the panic handler")
+	}
+
+	if _, err := d.Get(context.Background(), "base"); !errors.Is(err, ErrDoppelShutdown) {
+		t.Errorf("got error %v, want ErrDoppelShutdown", err)
+	}
+	for range d.Heartbeat() {
+	}
+	if out := logger.String(); !strings.Contains(out, "panicked") {
+		t.Errorf("panic wasn't logged:\n%s", out)
+	}
+}
+
+func TestWithLogSampling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := &testLogger{out: &bytes.Buffer{}}
+	rec := &eventRecorder{}
+	d, err := New(ctx, schematic, WithLogger(logger), WithLogSampling(3), WithEventHook(rec.record))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const gets = 9
+	for i := 0; i < gets; i++ {
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := logger.String()
+	// Each Get, plus the first request for each of withBody1's two bases, logs
+	// a received and a delivering message, of which one in three is sampled.
+	sampled := strings.Count(out, "received request") + strings.Count(out, "delivering template")
+	if want := (2*(gets+2) + 2) / 3; sampled != want {
+		t.Errorf("got %d sampled messages, want %d\n%s", sampled, want, out)
+	}
+	if got := strings.Count(out, "parsed successfully"); got != 3 {
+		t.Errorf("got %d parse messages, want 3 (parse results are never sampled)", got)
+	}
+
+	if got := rec.count(EventMiss, "withBody1") + rec.count(EventHit, "withBody1"); got != gets {
+		t.Errorf("got %d events for withBody1, want %d", got, gets)
+	}
+}
+
+func TestWithQueueLogging(t *testing.T) {
+	newDoppel := func(t *testing.T, ctx context.Context, opts ...CacheOption) (*Doppel, *testLogger) {
+		t.Helper()
+		logger := &testLogger{out: &bytes.Buffer{}}
+		d, err := New(ctx, schematic, append(opts, WithLogger(logger))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d, logger
+	}
+
+	t.Run("correlates queued and served requests", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, logger := newDoppel(t, ctx, WithQueueLogging())
+
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+
+		out := logger.String()
+		// withBody1 requests commonNav, which requests base.
+		for id, name := range []string{"withBody1", "commonNav", "base"} {
+			queued := fmt.Sprintf("queueing request %d for template %q", id+1, name)
+			if !strings.Contains(out, queued) {
+				t.Errorf("missing %q\n%s", queued, out)
+			}
+			served := regexp.MustCompile(fmt.Sprintf(`serving request %d for template %q after \S+ in queue`, id+1, name))
+			if !served.MatchString(out) {
+				t.Errorf("missing serving message for request %d (%s)\n%s", id+1, name, out)
+			}
+		}
+	})
+
+	t.Run("logs nothing extra by default", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, logger := newDoppel(t, ctx)
+
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+		if out := logger.String(); strings.Contains(out, "queue") {
+			t.Errorf("got queue messages without WithQueueLogging\n%s", out)
+		}
+	})
+}
+
+func TestWithOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fixture := filepath.Join(dir, "fixture.gohtml")
+	if err := ioutil.WriteFile(fixture, []byte(`{{define "body"}}fixture body{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	original, err := New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overridden, err := New(ctx, schematic, WithOverrides(CacheSchematic{
+		"withBody1": {BaseTmplName: "commonNav", Filepaths: []string{fixture}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execute := func(t *testing.T, d *Doppel) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := d.Execute(context.Background(), &buf, "withBody1", nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	if got := execute(t, overridden); !strings.Contains(got, "fixture body") {
+		t.Errorf("got %q, want the fixture body", got)
+	}
+	if got := execute(t, original); !strings.Contains(got, "first of two") {
+		t.Errorf("original Doppel got %q, want the production body", got)
+	}
+	if got := schematic["withBody1"].Filepaths; !reflect.DeepEqual(got, []string{body1Path}) {
+		t.Errorf("caller's schematic was modified: got Filepaths %v", got)
+	}
+}
+
+func TestWithNameNormalizer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rec := &eventRecorder{}
+	d, err := New(ctx, schematic, WithNameNormalizer(strings.ToLower), WithEventHook(rec.record))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("differently cased requests share a cache entry", func(t *testing.T) {
+		for _, name := range []string{"withBody1", "WITHBODY1", "withbody1"} {
+			if _, err := d.Get(context.Background(), name); err != nil {
+				t.Fatalf("Get(%q): %v", name, err)
+			}
+		}
+		if _, err := d.TryGet("WithBody1"); err != nil {
+			t.Errorf("TryGet: %v", err)
+		}
+		for _, name := range []string{"withbody1", "commonnav", "base"} {
+			if got := rec.count(EventMiss, name); got != 1 {
+				t.Errorf("%s: got %d misses, want 1", name, got)
+			}
+		}
+	})
+
+	t.Run("errors report the canonical name", func(t *testing.T) {
+		_, err := d.Get(context.Background(), "Missing")
+		var reqErr RequestError
+		if !errors.As(err, &reqErr) || reqErr.Target != "missing" {
+			t.Errorf("got error %v, want a RequestError for \"missing\"", err)
+		}
+	})
+
+	t.Run("rejects names that normalize to the same name", func(t *testing.T) {
+		cs := CacheSchematic{
+			"Page": {Filepaths: []string{basepath}},
+			"page": {Filepaths: []string{navpath}},
+		}
+		if _, err := New(ctx, cs, WithNameNormalizer(strings.ToLower)); !errors.Is(err, ErrInvalidSchematic) {
+			t.Errorf("got error %v, want ErrInvalidSchematic", err)
+		}
+	})
+
+	t.Run("the debug handler filters by the canonical name", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		d.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/doppel?name=WITHBODY1", nil))
+		var snap CacheSnapshot
+		if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+			t.Fatal(err)
+		}
+		if len(snap.Entries) != 1 || snap.Entries[0].Name != "withbody1" {
+			t.Errorf("got entries %v, want withbody1 alone", snap.Entries)
+		}
+	})
+
+	t.Run("smoke test probe data is normalized", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "doppel")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		probed := filepath.Join(dir, "probed.gohtml")
+		if err := ioutil.WriteFile(probed, []byte(`{{len .}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cs := CacheSchematic{"Probed": {Filepaths: []string{probed}}}
+
+		probes := map[string]interface{}{"PROBED": []int{1}}
+		if _, err := New(ctx, cs, WithNameNormalizer(strings.ToLower), WithSmokeTest(probes)); err != nil {
+			t.Errorf("got error %v, want the probe data to be found", err)
+		}
+
+		probes["probed"] = []int{2}
+		if _, err := New(ctx, cs, WithNameNormalizer(strings.ToLower), WithSmokeTest(probes)); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("got error %v, want ErrInvalidOption", err)
+		}
+	})
+}
+
+func TestWithFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/layout.gohtml": {Data: []byte(`[{{template "body"}}]`)},
+		"templates/page.gohtml":   {Data: []byte(`{{define "body"}}page{{end}}`)},
+	}
+	cs := CacheSchematic{
+		"layout": {Filepaths: []string{"templates/layout.gohtml"}},
+		"page":   {BaseTmplName: "layout", Filepaths: []string{"templates/page.gohtml"}},
+		"absent": {Filepaths: []string{basepath}}, // on disk, but not in fsys
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d, err := New(ctx, cs, WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := d.Execute(context.Background(), &buf, "page", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "[page]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := d.Get(context.Background(), "absent"); err == nil {
+		t.Error("got nil error for a file absent from the FS")
+	}
+}
+
+func TestWithVerboseErrors(t *testing.T) {
+	cs := schematic.Clone()
+	cs["unreadable"] = &TemplateSchematic{Filepaths: []string{filepath.Join(fixtures, "absent.gohtml")}}
+
+	errs := func(t *testing.T, verbose bool) []error {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, cs, WithVerboseErrors(verbose))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		canceled, cancelReq := context.WithCancel(context.Background())
+		cancelReq()
+		_, errCanceled := d.Get(canceled, "withBody1")
+		_, errMissing := d.Get(context.Background(), "missing")
+		_, errUnreadable := d.Get(context.Background(), "unreadable")
+		return []error{errCanceled, errMissing, errUnreadable}
+	}
+
+	verbose, terse := errs(t, true), errs(t, false)
+	targets := []error{context.Canceled, ErrSchematicNotFound, os.ErrNotExist}
+	for i, target := range targets {
+		if !errors.Is(verbose[i], target) || !errors.Is(terse[i], target) {
+			t.Errorf("got errors %v (verbose) and %v (terse), want both to match %v", verbose[i], terse[i], target)
+		}
+		if verbose[i].Error() != terse[i].Error() {
+			t.Errorf("got messages %q (verbose) and %q (terse), want them equal", verbose[i], terse[i])
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package doppel
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"time"
+)
+
+// ExecuteCached behaves like Execute, but caches the rendered output under the
+// pair (name, key) when the Doppel was configured with WithRenderCache.
+// Subsequent calls with the same name and key write the cached bytes to w
+// without executing the template until the output expires or the template is
+// invalidated. The caller is responsible for choosing a key that uniquely
+// identifies the data, including any context data.
+//
+// Without WithRenderCache, or in dev mode, ExecuteCached is equivalent to
+// Execute.
+func (d *Doppel) ExecuteCached(ctx context.Context, w io.Writer, name, key string, data interface{}) error {
+	out, err := d.render(ctx, name, key, data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// RenderCached behaves like ExecuteCached, but returns the rendered output
+// rather than writing it. The returned slice belongs to the caller.
+func (d *Doppel) RenderCached(ctx context.Context, name, key string, data interface{}) ([]byte, error) {
+	out, err := d.render(ctx, name, key, data)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), out...), nil // protect the cached output from modification
+}
+
+// render returns the output of the named template executed with data, served
+// from and stored in the render cache under key if it is enabled. The returned
+// slice may be shared with the render cache and must not be modified.
+func (d *Doppel) render(ctx context.Context, name, key string, data interface{}) ([]byte, error) {
+	out, compressed, err := d.renderStored(ctx, name, key, data)
+	if err != nil || !compressed {
+		return out, err
+	}
+	return gunzip(out)
+}
+
+// renderStored behaves like render, but returns output in the form it is
+// stored by the render cache, reporting whether it is gzip-compressed.
+func (d *Doppel) renderStored(ctx context.Context, name, key string, data interface{}) ([]byte, bool, error) {
+	name = d.canonical(name)
+	var buf bytes.Buffer
+	if d.renders == nil || d.devMode {
+		if err := d.Execute(ctx, &buf, name, data); err != nil {
+			return nil, false, err
+		}
+		return buf.Bytes(), false, nil
+	}
+
+	rk := renderKey{name, key}
+	var out []byte
+	var generation uint64
+	err := d.do(ctx, func(map[string]*cacheEntry) {
+		out = d.renders.get(rk, d.clock.Now())
+		generation = d.renders.generation
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if out != nil {
+		return out, d.compressRenders, nil
+	}
+
+	if err := d.Execute(ctx, &buf, name, data); err != nil {
+		return nil, false, err
+	}
+	out = buf.Bytes()
+	if d.compressRenders {
+		if out, err = gzipBytes(out); err != nil {
+			return nil, false, err
+		}
+	}
+
+	err = d.do(ctx, func(map[string]*cacheEntry) {
+		// Discard output rendered from a template invalidated in the meantime.
+		if d.renders.generation == generation {
+			d.renders.put(rk, out, d.clock.Now())
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return out, d.compressRenders, nil
+}
+
+type renderKey struct {
+	name, key string
+}
+
+type renderEntry struct {
+	key     renderKey
+	out     []byte
+	expires time.Time
+}
+
+// renderCache is an LRU cache of rendered output. It is confined to the cache
+// goroutine.
+type renderCache struct {
+	ttl        time.Duration
+	maxEntries int
+	generation uint64 // incremented on each invalidation
+	entries    map[renderKey]*list.Element
+	lru        *list.List // most recently used at the front
+}
+
+func newRenderCache(ttl time.Duration, maxEntries int) *renderCache {
+	return &renderCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[renderKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// get returns the output cached under rk, or nil if there is none or it has
+// expired.
+func (rc *renderCache) get(rk renderKey, now time.Time) []byte {
+	elem := rc.entries[rk]
+	if elem == nil {
+		return nil
+	}
+
+	re := elem.Value.(*renderEntry)
+	if rc.ttl > 0 && now.After(re.expires) {
+		rc.remove(elem)
+		return nil
+	}
+	rc.lru.MoveToFront(elem)
+	return re.out
+}
+
+func (rc *renderCache) put(rk renderKey, out []byte, now time.Time) {
+	if elem := rc.entries[rk]; elem != nil {
+		rc.remove(elem)
+	}
+
+	re := &renderEntry{key: rk, out: out, expires: now.Add(rc.ttl)}
+	rc.entries[rk] = rc.lru.PushFront(re)
+	for rc.maxEntries > 0 && rc.lru.Len() > rc.maxEntries {
+		rc.remove(rc.lru.Back())
+	}
+}
+
+func (rc *renderCache) remove(elem *list.Element) {
+	re := rc.lru.Remove(elem).(*renderEntry)
+	delete(rc.entries, re.key)
+}
+
+// invalidate removes all output rendered from the named templates.
+func (rc *renderCache) invalidate(names map[string]bool) {
+	rc.generation++
+	for rk, elem := range rc.entries {
+		if names[rk.name] {
+			rc.remove(elem)
+		}
+	}
+}
+
+// purge removes all cached output.
+func (rc *renderCache) purge() {
+	rc.generation++
+	rc.entries = make(map[renderKey]*list.Element)
+	rc.lru.Init()
+}
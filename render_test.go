@@ -0,0 +1,159 @@
+package doppel
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExecuteCached(t *testing.T) {
+	deliveries := func(t *testing.T, d *Doppel, name string) uint64 {
+		snap, err := d.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, es := range snap.Entries {
+			if es.Name == name {
+				return es.Deliveries
+			}
+		}
+		return 0
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, schematic, WithRenderCache(time.Hour, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var first bytes.Buffer
+	if err := d.ExecuteCached(context.Background(), &first, "withBody1", "k", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("serves cached output without executing the template", func(t *testing.T) {
+		var second bytes.Buffer
+		if err := d.ExecuteCached(context.Background(), &second, "withBody1", "k", nil); err != nil {
+			t.Fatal(err)
+		}
+		if second.String() != first.String() {
+			t.Errorf("got %q, want %q", second.String(), first.String())
+		}
+		if got := deliveries(t, d, "withBody1"); got != 1 {
+			t.Errorf("template was delivered %d times, want 1", got)
+		}
+	})
+
+	t.Run("discards output when a base template is invalidated", func(t *testing.T) {
+		if err := d.Invalidate(context.Background(), "base"); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := d.ExecuteCached(context.Background(), &buf, "withBody1", "k", nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := deliveries(t, d, "withBody1"); got != 1 {
+			t.Errorf("reparsed template was delivered %d times, want 1", got)
+		}
+	})
+}
+
+func TestRenderCached(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, schematic, WithRenderCache(time.Hour, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want bytes.Buffer
+	if err := d.Execute(context.Background(), &want, "withBody1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("returns the rendered output", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			out, err := d.RenderCached(context.Background(), "withBody1", "k", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != want.String() {
+				t.Errorf("call %d: got %q, want %q", i, out, want.String())
+			}
+		}
+	})
+
+	t.Run("protects cached output from modification", func(t *testing.T) {
+		out, err := d.RenderCached(context.Background(), "withBody1", "k", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range out {
+			out[i] = 0
+		}
+
+		again, err := d.RenderCached(context.Background(), "withBody1", "k", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(again) != want.String() {
+			t.Errorf("cached output was modified: got %q", again)
+		}
+	})
+}
+
+func TestRenderCache(t *testing.T) {
+	now := time.Now()
+	k1, k2, k3 := renderKey{"a", "1"}, renderKey{"a", "2"}, renderKey{"b", "1"}
+
+	t.Run("expires output after ttl", func(t *testing.T) {
+		rc := newRenderCache(time.Minute, 0)
+		rc.put(k1, []byte("out"), now)
+
+		if out := rc.get(k1, now.Add(time.Second)); string(out) != "out" {
+			t.Errorf("got %q before expiry, want \"out\"", out)
+		}
+		if out := rc.get(k1, now.Add(2*time.Minute)); out != nil {
+			t.Errorf("got %q after expiry, want nil", out)
+		}
+	})
+
+	t.Run("evicts the least recently used output beyond maxEntries", func(t *testing.T) {
+		rc := newRenderCache(0, 2)
+		rc.put(k1, []byte("1"), now)
+		rc.put(k2, []byte("2"), now)
+		rc.get(k1, now) // k2 is now least recently used
+		rc.put(k3, []byte("3"), now)
+
+		if rc.get(k2, now) != nil {
+			t.Error("least recently used output was retained")
+		}
+		if rc.get(k1, now) == nil || rc.get(k3, now) == nil {
+			t.Error("recently used output was evicted")
+		}
+	})
+
+	t.Run("invalidates output by template name", func(t *testing.T) {
+		rc := newRenderCache(0, 0)
+		for _, k := range []renderKey{k1, k2, k3} {
+			rc.put(k, []byte("out"), now)
+		}
+		gen := rc.generation
+		rc.invalidate(map[string]bool{"a": true})
+
+		if rc.get(k1, now) != nil || rc.get(k2, now) != nil {
+			t.Error("output of invalidated template was retained")
+		}
+		if rc.get(k3, now) == nil {
+			t.Error("output of other template was discarded")
+		}
+		if rc.generation == gen {
+			t.Error("generation was not incremented")
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package doppel
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// Render executes the named template with data as for Execute, bounded by r's
+// context, and writes the output to w as the response, setting a Content-Type
+// of text/html if none has been set.
+//
+// By default, output is buffered, so that if the template can't be retrieved
+// or fails to execute, nothing has been written and Render responds with 500
+// Internal Server Error instead. With WithStreamingRender, output is streamed
+// to w as for ExecuteStream: an error before any output is written still
+// produces a 500, but once output has been sent the status can't be changed,
+// so the error is logged and the response is cut short.
+//
+// Any error is also returned, for the caller's information. The response has
+// already been written, so the caller shouldn't write to w.
+func (d *Doppel) Render(w http.ResponseWriter, r *http.Request, name string, data interface{}) error {
+	if !d.streamingRender {
+		var buf bytes.Buffer
+		if err := d.Execute(r.Context(), &buf, name, data); err != nil {
+			d.renderFailed(w, name, err, false)
+			return err
+		}
+		setHTMLContentType(w)
+		_, err := buf.WriteTo(w)
+		return err
+	}
+
+	setHTMLContentType(w)
+	rw := &renderWriter{ResponseWriter: w}
+	if err := d.ExecuteStream(r.Context(), rw, name, data, 0); err != nil {
+		d.renderFailed(w, name, err, rw.wrote)
+		return err
+	}
+	return nil
+}
+
+// renderFailed responds to a failed render of the named template with 500
+// Internal Server Error, unless output has already been written, in which case
+// the status has been sent and the error is only logged.
+func (d *Doppel) renderFailed(w http.ResponseWriter, name string, err error, wrote bool) {
+	if wrote {
+		d.log.Printf(logRenderCutShort, name, err)
+		return
+	}
+	d.log.Printf(logRenderFailed, name, err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+func setHTMLContentType(w http.ResponseWriter) {
+	if h := w.Header(); h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "text/html; charset=utf-8")
+	}
+}
+
+// renderWriter records whether a streamed render has written to the response.
+type renderWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (rw *renderWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		rw.wrote = true
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, so that ExecuteStream flushes the underlying
+// writer if it supports it.
+func (rw *renderWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,99 @@
+package doppel
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "list.gohtml")
+	if err := ioutil.WriteFile(path, []byte(`items: {{index .items 1}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cs := CacheSchematic{"list": {Filepaths: []string{path}}}
+
+	// render renders the named template with items, returning the response and
+	// the Doppel's log output.
+	render := func(t *testing.T, name string, items []string, opts ...CacheOption) (*httptest.ResponseRecorder, string) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		log := &testLogger{out: &bytes.Buffer{}}
+		d, err := New(ctx, cs, append(opts, WithLogger(log))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		d.Render(w, httptest.NewRequest(http.MethodGet, "/", nil), name, map[string]interface{}{"items": items})
+		return w, log.String()
+	}
+
+	modes := []struct {
+		desc string
+		opts []CacheOption
+	}{
+		{"buffered", nil},
+		{"streaming", []CacheOption{WithStreamingRender()}},
+	}
+	for _, mode := range modes {
+		t.Run(mode.desc+": writes the output", func(t *testing.T) {
+			w, _ := render(t, "list", []string{"a", "b"}, mode.opts...)
+			if w.Code != http.StatusOK {
+				t.Errorf("got status %d, want 200", w.Code)
+			}
+			if got, want := w.Body.String(), "items: b"; got != want {
+				t.Errorf("got body %q, want %q", got, want)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+				t.Errorf("got Content-Type %q, want text/html", ct)
+			}
+		})
+
+		t.Run(mode.desc+": responds 500 if the template can't be retrieved", func(t *testing.T) {
+			w, logged := render(t, "missing", nil, mode.opts...)
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("got status %d, want 500", w.Code)
+			}
+			if !strings.Contains(logged, "rendering template \"missing\" failed") {
+				t.Errorf("got logs %q, want the failure logged", logged)
+			}
+		})
+	}
+
+	t.Run("responds 500 to execution errors when buffering", func(t *testing.T) {
+		w, _ := render(t, "list", nil)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("got status %d, want 500", w.Code)
+		}
+		if strings.Contains(w.Body.String(), "items:") {
+			t.Errorf("got body %q, want no partial output", w.Body.String())
+		}
+	})
+
+	t.Run("logs execution errors after output is streamed", func(t *testing.T) {
+		w, logged := render(t, "list", nil, WithStreamingRender())
+		if w.Code != http.StatusOK {
+			t.Errorf("got status %d, want the 200 already sent", w.Code)
+		}
+		if got, want := w.Body.String(), "items: "; got != want {
+			t.Errorf("got body %q, want %q", got, want)
+		}
+		if !strings.Contains(logged, "after output was sent") {
+			t.Errorf("got logs %q, want the failure logged", logged)
+		}
+	})
+}
@@ -1,9 +1,22 @@
 package doppel
 
-// A CacheSchematic is an acyclic graph of TemplateSchematics.
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A CacheSchematic is an acyclic graph of TemplateSchematics. Like any map, a
+// CacheSchematic is not safe for concurrent modification; use a
+// SyncCacheSchematic to build one from multiple goroutines.
 type CacheSchematic map[string]*TemplateSchematic
 
-// Clone returns a deep copy of the CacheSchematic.
+// Clone returns a deep copy of the CacheSchematic. Nil TemplateSchematics are
+// copied as nil.
 func (cs CacheSchematic) Clone() CacheSchematic {
 	dest := make(CacheSchematic, len(cs))
 	for k, v := range cs {
@@ -12,21 +25,509 @@ func (cs CacheSchematic) Clone() CacheSchematic {
 	return dest
 }
 
+// A SyncCacheSchematic builds a CacheSchematic safely from multiple goroutines.
+// The zero value is an empty schematic ready to use.
+type SyncCacheSchematic struct {
+	mu sync.Mutex
+	cs CacheSchematic
+}
+
+// Add stores a deep copy of ts under name, replacing any existing entry.
+func (scs *SyncCacheSchematic) Add(name string, ts *TemplateSchematic) {
+	ts = ts.Clone()
+	scs.mu.Lock()
+	defer scs.mu.Unlock()
+	if scs.cs == nil {
+		scs.cs = make(CacheSchematic)
+	}
+	scs.cs[name] = ts
+}
+
+// Schematic returns a deep copy of the CacheSchematic built so far, suitable
+// for passing to New.
+func (scs *SyncCacheSchematic) Schematic() CacheSchematic {
+	scs.mu.Lock()
+	defer scs.mu.Unlock()
+	return scs.cs.Clone()
+}
+
 // TemplateSchematic describes how to parse a template from a cached based
 // template and zero or more template files.
 //
 // BaseTmplName may be an empty string, indicating a template without a base.
+// Conversely, a TemplateSchematic with a base but no Filepaths or Includes is
+// an alias of its base, e.g. to publish a stable name for whichever template
+// currently backs a page. Requests for an alias receive a clone of its base.
+//
+// Includes names other TemplateSchematics, such as shared partials, whose files
+// are parsed into the template after its base and before its own Filepaths.
+// Included TemplateSchematics' own Includes are parsed too, but their base
+// templates are not.
+//
+// Filepaths are parsed in order, so where more than one file defines the same
+// template name, the last file wins. Schematics built by iterating over a map
+// should therefore sort their Filepaths, or be used with WithSortedFilepaths,
+// to compose the same template on every run.
+//
+// Internal marks a template that exists only as a building block for others,
+// e.g. to prevent user-influenced names passed to Get from fetching it. It may
+// be used as a base or include, but requesting it directly fails with
+// ErrInternalTemplate.
+//
+// Loader, if set, fetches the data to execute the template with when it is
+// rendered by Execute and friends, e.g. to preload a page's records for
+// server-side rendering. Loaded data lies beneath data from the request and its
+// context: maps are merged with the request's keys winning, and any other
+// non-nil value from the request replaces the loaded data. If Loader returns an
+// error, the template is not executed.
 type TemplateSchematic struct {
 	BaseTmplName string
 	Filepaths    []string
+	Includes     []string
+	Internal     bool
+	Loader       func(ctx context.Context) (interface{}, error) `json:"-"`
 }
 
-// Clone returns a pointer to deep copy of the underlying TemplateSchematic.
+// Clone returns a pointer to deep copy of the underlying TemplateSchematic, or
+// nil if ts is nil.
 func (ts *TemplateSchematic) Clone() *TemplateSchematic {
+	if ts == nil {
+		return nil
+	}
 	dest := &TemplateSchematic{
 		BaseTmplName: ts.BaseTmplName,
 		Filepaths:    make([]string, len(ts.Filepaths)),
+		Internal:     ts.Internal,
+		Loader:       ts.Loader,
 	}
 	copy(dest.Filepaths, ts.Filepaths)
+	if ts.Includes != nil {
+		dest.Includes = make([]string, len(ts.Includes))
+		copy(dest.Includes, ts.Includes)
+	}
 	return dest
 }
+
+// AddFile appends path to the TemplateSchematic's Filepaths unless it is
+// already present.
+//
+// AddFile is intended for building schematics before they are passed to New.
+// A Doppel works from its own copy of the schematic, so modifying a
+// TemplateSchematic that has already been passed to New has no effect on the
+// running cache.
+func (ts *TemplateSchematic) AddFile(path string) {
+	for _, fp := range ts.Filepaths {
+		if fp == path {
+			return
+		}
+	}
+	ts.Filepaths = append(ts.Filepaths, path)
+}
+
+// RemoveFile removes path from the TemplateSchematic's Filepaths, preserving
+// the order of the remaining paths.
+//
+// As with AddFile, modifying a TemplateSchematic that has already been passed
+// to New has no effect on the running cache.
+func (ts *TemplateSchematic) RemoveFile(path string) {
+	kept := ts.Filepaths[:0]
+	for _, fp := range ts.Filepaths {
+		if fp != path {
+			kept = append(kept, fp)
+		}
+	}
+	ts.Filepaths = kept
+}
+
+// sortFilepaths sorts the Filepaths of every entry in place.
+func (cs CacheSchematic) sortFilepaths() {
+	for _, ts := range cs {
+		if ts != nil {
+			sort.Strings(ts.Filepaths)
+		}
+	}
+}
+
+// normalized returns a deep copy of cs in which every entry's name, base
+// template and includes have been passed through normalize. It returns an
+// error matching ErrInvalidSchematic if two entries' names normalize to the
+// same name, and the error of IsCyclic if normalization makes the schematic
+// cyclic.
+func (cs CacheSchematic) normalized(normalize func(string) string) (CacheSchematic, error) {
+	dest := make(CacheSchematic, len(cs))
+	original := make(map[string]string, len(cs))
+	for _, name := range cs.names() {
+		canonical := normalize(name)
+		if prev, ok := original[canonical]; ok {
+			return nil, fmt.Errorf("schematics %q and %q both normalize to %q: %w", prev, name, canonical, ErrInvalidSchematic)
+		}
+		original[canonical] = name
+
+		ts := cs[name].Clone()
+		if ts != nil {
+			if ts.BaseTmplName != "" {
+				ts.BaseTmplName = normalize(ts.BaseTmplName)
+			}
+			for i, inc := range ts.Includes {
+				ts.Includes[i] = normalize(inc)
+			}
+		}
+		dest[canonical] = ts
+	}
+	if cyclic, err := IsCyclic(dest); cyclic {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// names returns the names of the CacheSchematic's entries in sorted order, so
+// that errors concerning them are reported deterministically.
+func (cs CacheSchematic) names() []string {
+	names := make([]string, 0, len(cs))
+	for name := range cs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validate returns ErrEmptySchematic if the CacheSchematic has no entries,
+// unless allowEmpty is true, ErrNilTemplateSchematic if any of its entries
+// is nil, ErrDuplicateFilepath if any entry names the same file twice, or
+// ErrSchematicNotFound if any entry includes a template absent from the
+// CacheSchematic.
+func (cs CacheSchematic) validate(allowEmpty bool) error {
+	if len(cs) == 0 && !allowEmpty {
+		return ErrEmptySchematic
+	}
+
+	for _, name := range cs.names() {
+		if cs[name] == nil {
+			return fmt.Errorf("schematic %q: %w", name, ErrNilTemplateSchematic)
+		}
+		seen := make(map[string]bool, len(cs[name].Filepaths))
+		for _, path := range cs[name].Filepaths {
+			if seen[path] {
+				return fmt.Errorf("schematic %q: %s: %w", name, path, ErrDuplicateFilepath)
+			}
+			seen[path] = true
+		}
+		for _, inc := range cs[name].Includes {
+			if cs[inc] == nil {
+				return fmt.Errorf("schematic %q includes %q: %w", name, inc, ErrSchematicNotFound)
+			}
+		}
+	}
+	return nil
+}
+
+// unusedInternal returns the names of the CacheSchematic's internal entries
+// that no other entry uses as a base or include, in sorted order. Such entries
+// can never be requested, which usually indicates a mistake.
+func (cs CacheSchematic) unusedInternal() []string {
+	var unused []string
+	for _, name := range cs.names() {
+		if cs[name].Internal && len(cs.dependents(name)) == 0 {
+			unused = append(unused, name)
+		}
+	}
+	return unused
+}
+
+// ApplyBaseRule sets the BaseTmplName of every entry whose name matches
+// pattern, other than base itself, to base. Patterns use the syntax of
+// path.Match, so "pages/*" matches "pages/home" but not "pages/admin/users".
+//
+// ApplyBaseRule returns ErrSchematicNotFound if base is absent from the
+// CacheSchematic, and an error if pattern is malformed or if the rule would
+// make the CacheSchematic cyclic, in which case no entries are modified. As
+// with AddFile, modifying a CacheSchematic that has already been passed to New
+// has no effect on the running cache.
+func (cs CacheSchematic) ApplyBaseRule(pattern, base string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("base rule %q: %w", pattern, err)
+	}
+	if cs[base] == nil {
+		return fmt.Errorf("base rule %q names base %q: %w", pattern, base, ErrSchematicNotFound)
+	}
+
+	var matched []string
+	for _, name := range cs.names() {
+		if ok, _ := path.Match(pattern, name); ok && name != base && cs[name] != nil {
+			matched = append(matched, name)
+		}
+	}
+
+	// Check the graph with the rule applied before modifying any entries.
+	ruled := make(CacheSchematic, len(cs))
+	for name, ts := range cs {
+		ruled[name] = ts
+	}
+	for _, name := range matched {
+		ts := *cs[name]
+		ts.BaseTmplName = base
+		ruled[name] = &ts
+	}
+	if cyclic, err := IsCyclic(ruled); cyclic {
+		return fmt.Errorf("base rule %q: %w", pattern, err)
+	}
+
+	for _, name := range matched {
+		cs[name].BaseTmplName = base
+	}
+	return nil
+}
+
+// partialGroupPrefix marks an entry in a TemplateSchematic's Filepaths as a
+// reference to a partial group registered via WithPartialGroup.
+const partialGroupPrefix = "@"
+
+// expandGroups returns a deep copy of cs in which each reference to a partial
+// group in an entry's Filepaths is replaced by the group's files, in order. It
+// returns ErrUnknownPartialGroup if an entry references a group absent from
+// groups.
+func (cs CacheSchematic) expandGroups(groups map[string][]string) (CacheSchematic, error) {
+	dest := make(CacheSchematic, len(cs))
+	for _, name := range cs.names() {
+		ts := cs[name].Clone()
+		dest[name] = ts
+		if ts == nil {
+			continue
+		}
+
+		var expanded []string
+		for i, path := range ts.Filepaths {
+			if !strings.HasPrefix(path, partialGroupPrefix) {
+				if expanded != nil {
+					expanded = append(expanded, path)
+				}
+				continue
+			}
+
+			group := strings.TrimPrefix(path, partialGroupPrefix)
+			files, ok := groups[group]
+			if !ok {
+				return nil, fmt.Errorf("schematic %q references group %q: %w", name, group, ErrUnknownPartialGroup)
+			}
+			if expanded == nil {
+				expanded = append(expanded, ts.Filepaths[:i]...)
+			}
+			expanded = append(expanded, files...)
+		}
+		if expanded != nil {
+			ts.Filepaths = expanded
+		}
+	}
+	return dest, nil
+}
+
+// depth returns the number of templates in name's chain of base templates,
+// including name itself.
+func (cs CacheSchematic) depth(name string) int {
+	var n int
+	seen := make(map[string]bool) // guard against cycles
+	for ts := cs[name]; ts != nil && !seen[name]; ts = cs[name] {
+		seen[name] = true
+		n++
+		name = ts.BaseTmplName
+	}
+	return n
+}
+
+// lineage returns the names of the templates in name's chain of base
+// templates, root first, excluding name itself. It reports false if any
+// template in the chain, including name, is absent from the CacheSchematic or
+// names no files.
+func (cs CacheSchematic) lineage(name string) ([]string, bool) {
+	ts := cs[name]
+	if ts == nil || len(ts.Filepaths) == 0 {
+		return nil, false
+	}
+
+	var bases []string
+	seen := map[string]bool{name: true} // guard against cycles
+	for base := ts.BaseTmplName; base != ""; base = ts.BaseTmplName {
+		ts = cs[base]
+		if ts == nil || len(ts.Filepaths) == 0 || seen[base] {
+			return nil, false
+		}
+		seen[base] = true
+		bases = append(bases, base)
+	}
+
+	// Reverse the chain so that the root comes first.
+	for i, j := 0, len(bases)-1; i < j; i, j = i+1, j-1 {
+		bases[i], bases[j] = bases[j], bases[i]
+	}
+	return bases, true
+}
+
+// edges returns the names of the templates the named template is composed
+// from: its base, if any, followed by its includes.
+func (cs CacheSchematic) edges(name string) []string {
+	ts := cs[name]
+	if ts == nil {
+		return nil
+	}
+
+	edges := make([]string, 0, len(ts.Includes)+1)
+	if ts.BaseTmplName != "" {
+		edges = append(edges, ts.BaseTmplName)
+	}
+	return append(edges, ts.Includes...)
+}
+
+// includedFiles returns the files of the templates the named template
+// includes, in the order they are parsed. Each included template's own
+// includes precede its files, and no file is listed twice.
+func (cs CacheSchematic) includedFiles(name string) []string {
+	var files []string
+	seenFiles := make(map[string]bool)
+	seen := map[string]bool{name: true} // guard against cycles
+
+	var visit func(ts *TemplateSchematic)
+	visit = func(ts *TemplateSchematic) {
+		for _, inc := range ts.Includes {
+			if seen[inc] || cs[inc] == nil {
+				continue
+			}
+			seen[inc] = true
+			visit(cs[inc])
+			for _, path := range cs[inc].Filepaths {
+				if !seenFiles[path] {
+					seenFiles[path] = true
+					files = append(files, path)
+				}
+			}
+		}
+	}
+	if ts := cs[name]; ts != nil {
+		visit(ts)
+	}
+	return files
+}
+
+// FilesFor returns the files parsed to compose the named template, in the order
+// they are parsed: those of its base template, recursively, then those of its
+// includes, then its own. Paths are cleaned and listed once each. References
+// to partial groups are returned as written; Doppel.FilesFor expands them.
+//
+// FilesFor returns an error matching ErrSchematicNotFound if name, or any
+// template it is composed from, is absent from the CacheSchematic, describing
+// the chain of base templates that led to it, and the error of IsCyclic if the
+// CacheSchematic is cyclic.
+func (cs CacheSchematic) FilesFor(name string) ([]string, error) {
+	if cyclic, err := IsCyclic(cs); cyclic {
+		return nil, err
+	}
+	return cs.filesFor(name)
+}
+
+// filesFor behaves like FilesFor, but assumes that cs is acyclic.
+func (cs CacheSchematic) filesFor(name string) ([]string, error) {
+	var chain []string // name first
+	for next := name; next != ""; next = cs[next].BaseTmplName {
+		chain = append(chain, next)
+		if cs[next] == nil {
+			return nil, fmt.Errorf("%s: %w", strings.Join(chain, " -> "), ErrSchematicNotFound)
+		}
+	}
+
+	var files []string
+	seenFiles := make(map[string]bool)
+	add := func(paths []string) {
+		for _, path := range paths {
+			path = filepath.Clean(path)
+			if !seenFiles[path] {
+				seenFiles[path] = true
+				files = append(files, path)
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	var include func(ts *TemplateSchematic) error
+	include = func(ts *TemplateSchematic) error {
+		for _, inc := range ts.Includes {
+			if seen[inc] {
+				continue
+			}
+			seen[inc] = true
+			if cs[inc] == nil {
+				return fmt.Errorf("include %q: %w", inc, ErrSchematicNotFound)
+			}
+			if err := include(cs[inc]); err != nil {
+				return err
+			}
+			add(cs[inc].Filepaths)
+		}
+		return nil
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		ts := cs[chain[i]]
+		if err := include(ts); err != nil {
+			return nil, fmt.Errorf("%s: %w", strings.Join(chain[:i+1], " -> "), err)
+		}
+		add(ts.Filepaths)
+	}
+	return files, nil
+}
+
+// Dependents returns the names of every template composed from the named
+// template, directly or transitively, whether as a base template or an
+// include, in sorted order. These are the templates that Invalidate evicts
+// along with name, and that may break if it changes. Dependents tolerates
+// cyclic schematics.
+func (cs CacheSchematic) Dependents(name string) []string {
+	deps := cs.dependents(name)
+	names := make([]string, 0, len(deps))
+	for dep := range deps {
+		names = append(names, dep)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dependents returns the set of templates composed from name, whether as a
+// base template or an include, directly or indirectly.
+func (cs CacheSchematic) dependents(name string) map[string]bool {
+	composers := make(map[string][]string) // the reverse of edges
+	for dependent := range cs {
+		for _, dependency := range cs.edges(dependent) {
+			composers[dependency] = append(composers[dependency], dependent)
+		}
+	}
+
+	deps := make(map[string]bool)
+	queue := []string{name}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, dependent := range composers[next] {
+			if !deps[dependent] {
+				deps[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	return deps
+}
+
+// equal reports whether ts and other describe the same template.
+func (ts *TemplateSchematic) equal(other *TemplateSchematic) bool {
+	return ts.BaseTmplName == other.BaseTmplName &&
+		equalStrings(ts.Filepaths, other.Filepaths) &&
+		equalStrings(ts.Includes, other.Includes)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
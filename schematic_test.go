@@ -0,0 +1,400 @@
+package doppel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTemplateSchematicAddFile(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		start []string
+		add   string
+		want  []string
+	}{
+		{"appends new paths", []string{"a"}, "b", []string{"a", "b"}},
+		{"adds to empty Filepaths", nil, "a", []string{"a"}},
+		{"ignores duplicate paths", []string{"a", "b"}, "a", []string{"a", "b"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ts := &TemplateSchematic{Filepaths: tc.start}
+			ts.AddFile(tc.add)
+			if !reflect.DeepEqual(ts.Filepaths, tc.want) {
+				t.Errorf("got %v, want %v", ts.Filepaths, tc.want)
+			}
+		})
+	}
+}
+
+func TestTemplateSchematicRemoveFile(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		start  []string
+		remove string
+		want   []string
+	}{
+		{"removes the path", []string{"a", "b", "c"}, "b", []string{"a", "c"}},
+		{"removes every occurrence", []string{"a", "b", "a"}, "a", []string{"b"}},
+		{"ignores absent paths", []string{"a"}, "b", []string{"a"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ts := &TemplateSchematic{Filepaths: tc.start}
+			ts.RemoveFile(tc.remove)
+			if !reflect.DeepEqual(ts.Filepaths, tc.want) {
+				t.Errorf("got %v, want %v", ts.Filepaths, tc.want)
+			}
+		})
+	}
+}
+
+func TestCacheSchematicApplyBaseRule(t *testing.T) {
+	newSchematic := func() CacheSchematic {
+		return CacheSchematic{
+			"layout":            {Filepaths: []string{"layout"}},
+			"pages/home":        {Filepaths: []string{"home"}},
+			"pages/about":       {BaseTmplName: "other", Filepaths: []string{"about"}},
+			"pages/admin/users": {Filepaths: []string{"users"}},
+			"other":             {Filepaths: []string{"other"}},
+		}
+	}
+
+	t.Run("sets the base of matching entries", func(t *testing.T) {
+		cs := newSchematic()
+		if err := cs.ApplyBaseRule("pages/*", "layout"); err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]string{
+			"layout":            "",
+			"pages/home":        "layout",
+			"pages/about":       "layout",
+			"pages/admin/users": "",
+			"other":             "",
+		}
+		for name, base := range want {
+			if got := cs[name].BaseTmplName; got != base {
+				t.Errorf("%s: got base %q, want %q", name, got, base)
+			}
+		}
+	})
+
+	t.Run("the base is never its own base", func(t *testing.T) {
+		cs := newSchematic()
+		if err := cs.ApplyBaseRule("*", "layout"); err != nil {
+			t.Fatal(err)
+		}
+		if got := cs["layout"].BaseTmplName; got != "" {
+			t.Errorf("got base %q, want none", got)
+		}
+	})
+
+	t.Run("rejects rules that create cycles", func(t *testing.T) {
+		cs := newSchematic()
+		cs["layout"].BaseTmplName = "pages/home"
+		if err := cs.ApplyBaseRule("pages/*", "layout"); err == nil {
+			t.Fatal("got nil error, want cycle error")
+		}
+		if got := cs["pages/about"].BaseTmplName; got != "other" {
+			t.Errorf("got base %q, want the entry to be unmodified", got)
+		}
+	})
+
+	t.Run("rejects missing bases", func(t *testing.T) {
+		if err := newSchematic().ApplyBaseRule("pages/*", "missing"); !errors.Is(err, ErrSchematicNotFound) {
+			t.Errorf("got error %v, want ErrSchematicNotFound", err)
+		}
+	})
+
+	t.Run("rejects malformed patterns", func(t *testing.T) {
+		if err := newSchematic().ApplyBaseRule("pages/[", "layout"); err == nil {
+			t.Error("got nil error, want bad pattern error")
+		}
+	})
+}
+
+func TestCacheSchematicDependents(t *testing.T) {
+	cs := schematic.Clone()
+	cs["flash"] = &TemplateSchematic{Filepaths: []string{"flash"}}
+	cs["withBody2"].Includes = []string{"flash"}
+	cs["withBody3"] = &TemplateSchematic{BaseTmplName: "withBody2", Filepaths: []string{"body3"}}
+
+	testCases := []struct {
+		name string
+		want []string
+	}{
+		{"base", []string{"commonNav", "withBody1", "withBody2", "withBody3"}},
+		{"commonNav", []string{"withBody1", "withBody2", "withBody3"}},
+		{"flash", []string{"withBody2", "withBody3"}},
+		{"withBody1", []string{}},
+		{"missing", []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := cs.Dependents(tc.name); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("tolerates cycles", func(t *testing.T) {
+		cyclic := schematic.Clone()
+		cyclic["base"].BaseTmplName = "withBody1"
+		want := []string{"base", "commonNav", "withBody1", "withBody2"}
+		if got := cyclic.Dependents("base"); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestCacheSchematicClone(t *testing.T) {
+	t.Run("tolerates nil entries", func(t *testing.T) {
+		cs := CacheSchematic{"nil": nil, "base": {Filepaths: []string{"base.gohtml"}}}
+
+		clone := cs.Clone()
+		if ts, ok := clone["nil"]; !ok || ts != nil {
+			t.Errorf("got %+v, want nil entry", ts)
+		}
+		if clone["base"] == cs["base"] {
+			t.Error("entry was not cloned")
+		}
+	})
+
+	t.Run("returns nil for a nil TemplateSchematic", func(t *testing.T) {
+		var ts *TemplateSchematic
+		if clone := ts.Clone(); clone != nil {
+			t.Errorf("got %+v, want nil", clone)
+		}
+	})
+}
+
+func TestCacheSchematicFilesFor(t *testing.T) {
+	t.Run("lists a template's files in parse order", func(t *testing.T) {
+		got, err := schematic.FilesFor("withBody1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{basepath, navpath, body1Path}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("includes, cleans and deduplicates files", func(t *testing.T) {
+		cs := CacheSchematic{
+			"layout":  {Filepaths: []string{"layout.gohtml"}},
+			"icons":   {Filepaths: []string{"icons.gohtml"}},
+			"widgets": {Filepaths: []string{"./widgets.gohtml"}, Includes: []string{"icons"}},
+			"page": {
+				BaseTmplName: "layout",
+				Filepaths:    []string{"pages/../page.gohtml", "widgets.gohtml", "@forms"},
+				Includes:     []string{"widgets"},
+			},
+		}
+		got, err := cs.FilesFor("page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"layout.gohtml", "icons.gohtml", "widgets.gohtml", "page.gohtml", "@forms"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("returns ErrSchematicNotFound with the chain to a missing template", func(t *testing.T) {
+		cs := schematic.Clone()
+		cs["orphan"] = &TemplateSchematic{BaseTmplName: "lost", Filepaths: []string{body1Path}}
+		cs["stray"] = &TemplateSchematic{BaseTmplName: "orphan", Filepaths: []string{body2Path}}
+
+		testCases := []struct {
+			name, chain string
+		}{
+			{"missing", "missing"},
+			{"stray", "stray -> orphan -> lost"},
+		}
+		for _, tc := range testCases {
+			_, err := cs.FilesFor(tc.name)
+			if !errors.Is(err, ErrSchematicNotFound) {
+				t.Errorf("%s: got error %v, want ErrSchematicNotFound", tc.name, err)
+			} else if !strings.Contains(err.Error(), tc.chain) {
+				t.Errorf("%s: got error %v, want chain %q", tc.name, err, tc.chain)
+			}
+		}
+	})
+}
+
+func TestSyncCacheSchematic(t *testing.T) {
+	t.Run("concurrent Adds are all kept", func(t *testing.T) {
+		const n = 50
+		var scs SyncCacheSchematic
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			name := fmt.Sprintf("tmpl-%d", i)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				scs.Add(name, &TemplateSchematic{Filepaths: []string{name + ".gohtml"}})
+				scs.Schematic()
+			}()
+		}
+		wg.Wait()
+
+		cs := scs.Schematic()
+		if len(cs) != n {
+			t.Fatalf("got %d entries, want %d", len(cs), n)
+		}
+		for name, ts := range cs {
+			if want := []string{name + ".gohtml"}; !reflect.DeepEqual(ts.Filepaths, want) {
+				t.Errorf("%s: got Filepaths %v, want %v", name, ts.Filepaths, want)
+			}
+		}
+	})
+
+	t.Run("Add and Schematic copy their entries", func(t *testing.T) {
+		var scs SyncCacheSchematic
+		ts := &TemplateSchematic{Filepaths: []string{"base.gohtml"}}
+		scs.Add("base", ts)
+		ts.AddFile("added.gohtml")
+
+		cs := scs.Schematic()
+		cs["base"].AddFile("other.gohtml")
+		if got := scs.Schematic()["base"].Filepaths; !reflect.DeepEqual(got, []string{"base.gohtml"}) {
+			t.Errorf("got Filepaths %v, want [base.gohtml]", got)
+		}
+	})
+
+	t.Run("the zero value is empty", func(t *testing.T) {
+		var scs SyncCacheSchematic
+		if cs := scs.Schematic(); cs == nil || len(cs) != 0 {
+			t.Errorf("got %v, want an empty, non-nil schematic", cs)
+		}
+	})
+}
+
+func TestIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	flashPath := write("flash.gohtml", `{{define "flash"}}saved{{end}}`)
+	includesSchematic := CacheSchematic{
+		"flash":  {Filepaths: []string{flashPath}},
+		"layout": {Filepaths: []string{write("layout.gohtml", `[{{template "body" .}}]`)}},
+		"pageA": {
+			Filepaths: []string{write("page_a.gohtml", `A: {{template "flash"}}`)},
+			Includes:  []string{"flash"},
+		},
+		"pageB": {
+			BaseTmplName: "layout",
+			Filepaths:    []string{write("page_b.gohtml", `{{define "body"}}B: {{template "flash"}}{{end}}`)},
+			Includes:     []string{"flash"},
+		},
+	}
+	want := map[string]string{
+		"pageA": "A: saved",
+		"pageB": "[B: saved]",
+	}
+
+	render := func(t *testing.T, d *Doppel, name string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := d.Execute(context.Background(), &buf, name, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	for _, tc := range []struct {
+		desc string
+		opts []CacheOption
+	}{
+		{"incremental", nil},
+		{"single pass", []CacheOption{WithSinglePassParsing()}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d, err := New(ctx, includesSchematic, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Run("merges included files into each template", func(t *testing.T) {
+				for name, wantOut := range want {
+					if got := render(t, d, name); got != wantOut {
+						t.Errorf("%s: got %q, want %q", name, got, wantOut)
+					}
+				}
+			})
+
+			t.Run("invalidating an include cascades to every template including it", func(t *testing.T) {
+				write("flash.gohtml", `{{define "flash"}}updated{{end}}`)
+				defer write("flash.gohtml", `{{define "flash"}}saved{{end}}`)
+				if err := d.Invalidate(context.Background(), "flash"); err != nil {
+					t.Fatal(err)
+				}
+
+				for name, wantOut := range want {
+					wantOut = strings.Replace(wantOut, "saved", "updated", 1)
+					if got := render(t, d, name); got != wantOut {
+						t.Errorf("%s: got %q, want %q", name, got, wantOut)
+					}
+				}
+			})
+		})
+	}
+
+	t.Run("cycles through includes are detected", func(t *testing.T) {
+		cyclic := includesSchematic.Clone()
+		cyclic["flash"].Includes = []string{"pageA"}
+		if cycle, _ := IsCyclic(cyclic); !cycle {
+			t.Error("failed to detect cycle through includes")
+		}
+
+		cyclic = includesSchematic.Clone()
+		cyclic["layout"].Includes = []string{"pageB"}
+		if cycle, _ := IsCyclic(cyclic); !cycle {
+			t.Error("failed to detect cycle through a base and an include")
+		}
+	})
+
+	t.Run("missing includes are rejected", func(t *testing.T) {
+		missing := includesSchematic.Clone()
+		missing["pageA"].Includes = []string{"missing"}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if _, err := New(ctx, missing); !errors.Is(err, ErrSchematicNotFound) {
+			t.Errorf("got error %v, want ErrSchematicNotFound", err)
+		}
+	})
+
+	t.Run("Clone copies includes", func(t *testing.T) {
+		clone := includesSchematic.Clone()
+		clone["pageA"].Includes[0] = "modified"
+		if includesSchematic["pageA"].Includes[0] != "flash" {
+			t.Error("clone shares includes with the original")
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package doppel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseSchematicText reads a CacheSchematic from r in a line-oriented text
+// format that is convenient to edit by hand and to diff. Each line describes
+// one template:
+//
+//	name: base -> file1, file2
+//
+// The base template and arrow may be omitted for templates without a base, as
+// in "base: layout.gohtml", and the files may be omitted for templates that
+// consist of their base alone, as in "alias: base ->". Blank lines and lines
+// beginning with # are ignored.
+//
+// ParseSchematicText returns an error matching ErrSchematicSyntax that
+// identifies the line number of the first malformed line, including lines that
+// redefine a template. The returned CacheSchematic is not otherwise validated;
+// New checks it for cycles and other errors as usual.
+func ParseSchematicText(r io.Reader) (CacheSchematic, error) {
+	cs := make(CacheSchematic)
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, ts, err := parseSchematicLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", lineNo, err, ErrSchematicSyntax)
+		}
+		if cs[name] != nil {
+			return nil, fmt.Errorf("line %d: template %q defined more than once: %w", lineNo, name, ErrSchematicSyntax)
+		}
+		cs[name] = ts
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// parseSchematicLine parses a single non-blank, non-comment line of the format
+// read by ParseSchematicText. Its errors describe the problem with the line.
+func parseSchematicLine(line string) (string, *TemplateSchematic, error) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return "", nil, fmt.Errorf("missing ':' after template name in %q", line)
+	}
+	name := strings.TrimSpace(line[:colon])
+	if name == "" {
+		return "", nil, fmt.Errorf("missing template name in %q", line)
+	}
+
+	ts := &TemplateSchematic{}
+	files := line[colon+1:]
+	if arrow := strings.Index(files, "->"); arrow >= 0 {
+		ts.BaseTmplName = strings.TrimSpace(files[:arrow])
+		if ts.BaseTmplName == "" {
+			return "", nil, fmt.Errorf("missing base template before '->' in %q", line)
+		}
+		files = files[arrow+len("->"):]
+	}
+
+	if strings.TrimSpace(files) == "" {
+		if ts.BaseTmplName == "" {
+			return "", nil, fmt.Errorf("template %q has no base template or files", name)
+		}
+		return name, ts, nil
+	}
+	for _, path := range strings.Split(files, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return "", nil, fmt.Errorf("empty file path in %q", line)
+		}
+		ts.Filepaths = append(ts.Filepaths, path)
+	}
+	return name, ts, nil
+}
@@ -0,0 +1,73 @@
+package doppel
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSchematicText(t *testing.T) {
+	t.Run("parses each line", func(t *testing.T) {
+		src := `
+# Layouts
+base: base.gohtml
+commonNav: base -> nav.gohtml
+
+withBody1: commonNav -> body_1.gohtml, sidebar.gohtml
+  alias :  withBody1 ->
+`
+		cs, err := ParseSchematicText(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := CacheSchematic{
+			"base":      {Filepaths: []string{"base.gohtml"}},
+			"commonNav": {BaseTmplName: "base", Filepaths: []string{"nav.gohtml"}},
+			"withBody1": {BaseTmplName: "commonNav", Filepaths: []string{"body_1.gohtml", "sidebar.gohtml"}},
+			"alias":     {BaseTmplName: "withBody1"},
+		}
+		if !reflect.DeepEqual(cs, want) {
+			t.Errorf("got %v, want %v", cs, want)
+		}
+	})
+
+	t.Run("parses fixtures usable by New", func(t *testing.T) {
+		src := "base: " + basepath + "\n" +
+			"commonNav: base -> " + navpath + "\n" +
+			"withBody1: commonNav -> " + body1Path + "\n"
+		cs, err := ParseSchematicText(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckSchematic(context.Background(), cs); err != nil {
+			t.Error(err)
+		}
+	})
+
+	testCases := []struct {
+		desc     string
+		src      string
+		wantLine string
+	}{
+		{"missing colon", "base: a.gohtml\nnav base -> b.gohtml", "line 2:"},
+		{"missing name", "# comment\n: a.gohtml", "line 2:"},
+		{"missing base", "nav: -> a.gohtml", "line 1:"},
+		{"nothing to parse", "\n\nnav:", "line 3:"},
+		{"empty file path", "nav: base -> a.gohtml,, b.gohtml", "line 1:"},
+		{"duplicate name", "nav: a.gohtml\nnav: b.gohtml", "line 2:"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ParseSchematicText(strings.NewReader(tc.src))
+			if !errors.Is(err, ErrSchematicSyntax) {
+				t.Fatalf("got error %v, want ErrSchematicSyntax", err)
+			}
+			if !strings.HasPrefix(err.Error(), tc.wantLine) {
+				t.Errorf("error %q does not begin with %q", err, tc.wantLine)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package doppel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+)
+
+// runSmokeTest parses every template in the schematic and executes it with the
+// probe data registered via WithSmokeTest, returning an error matching
+// ErrSmokeTestFailed that joins the errors of every template that fails to
+// parse or execute. Templates without probe data are executed with nil data,
+// unless WithSmokeTestSkipUnprobed was supplied. Templates whose base fails to
+// parse are not reported separately.
+func (d *Doppel) runSmokeTest(ctx context.Context) error {
+	c := newSchematicChecker(d, d.schematic)
+	var failed []error
+	for _, name := range d.schematic.names() {
+		data, probed := d.smokeData[name]
+		if !probed && d.smokeSkipUnprobed {
+			continue
+		}
+
+		tmpl, err := c.check(ctx, name)
+		if ctx.Err() != nil {
+			return fmt.Errorf("New interrupted during smoke test: %w", ctx.Err())
+		}
+		if errors.Is(err, errBaseInvalid) {
+			continue
+		}
+		if err == nil {
+			if tmpl, err = tmpl.Clone(); err == nil {
+				err = d.smokeExecute(ctx, tmpl, data)
+			}
+		}
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrSmokeTestFailed, errors.Join(failed...))
+}
+
+func (d *Doppel) smokeExecute(ctx context.Context, tmpl *template.Template, data interface{}) error {
+	if d.executeTimeout <= 0 {
+		return tmpl.Execute(ioutil.Discard, data)
+	}
+	return d.executeWithTimeout(ctx, ioutil.Discard, tmpl, data)
+}
@@ -0,0 +1,101 @@
+package doppel
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithSmokeTest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doppel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// Both templates parse, but fail to execute without suitable data.
+	smokeSchematic := schematic.Clone()
+	smokeSchematic["withUser"] = &TemplateSchematic{
+		Filepaths: []string{write("user.gohtml", `{{.User.Name}}`)},
+	}
+	smokeSchematic["withMissing"] = &TemplateSchematic{
+		BaseTmplName: "commonNav",
+		Filepaths:    []string{write("missing.gohtml", `{{define "body"}}{{template "missing"}}{{end}}`)},
+	}
+	type user struct{ Name string }
+
+	testCases := []struct {
+		desc       string
+		opts       []CacheOption
+		wantFailed []string // templates expected to be reported by the smoke test
+	}{
+		{
+			desc:       "every failure is reported",
+			opts:       []CacheOption{WithSmokeTest(map[string]interface{}{"withUser": 42})},
+			wantFailed: []string{"base", "commonNav", "withMissing", "withUser"},
+		},
+		{
+			desc: "unprobed templates are skipped",
+			opts: []CacheOption{
+				WithSmokeTest(map[string]interface{}{"withUser": 42}),
+				WithSmokeTestSkipUnprobed(),
+			},
+			wantFailed: []string{"withUser"},
+		},
+		{
+			desc: "probe data satisfies templates",
+			opts: []CacheOption{
+				WithSmokeTest(map[string]interface{}{
+					"withUser": map[string]interface{}{"User": user{"Ada"}},
+				}),
+				WithSmokeTestSkipUnprobed(),
+			},
+		},
+		{
+			desc: "no smoke test",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d, err := New(ctx, smokeSchematic, tc.opts...)
+			if len(tc.wantFailed) == 0 {
+				if err != nil {
+					t.Fatalf("got error %v, want nil", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrSmokeTestFailed) {
+				t.Fatalf("got error %v, want ErrSmokeTestFailed", err)
+			}
+			if d != nil {
+				t.Errorf("got *Doppel %+v, want nil", d)
+			}
+			want := make(map[string]bool)
+			for _, name := range tc.wantFailed {
+				want[name] = true
+			}
+			for name := range smokeSchematic {
+				if got := strings.Contains(err.Error(), name+":"); got != want[name] {
+					t.Errorf("reported %s: got %t, want %t (error %q)", name, got, want[name], err)
+				}
+			}
+		})
+	}
+}
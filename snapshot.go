@@ -0,0 +1,328 @@
+package doppel
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// An op is executed by the cache goroutine with exclusive access to the cache,
+// allowing callers to inspect or modify its entries without locks.
+type op func(cache map[string]*cacheEntry)
+
+// do sends fn to the cache goroutine and waits for it to complete. do can be
+// preempted via ctx until fn has been accepted by the cache.
+func (d *Doppel) do(ctx context.Context, fn op) error {
+	done := make(chan struct{})
+	wrapped := func(cache map[string]*cacheEntry) {
+		defer close(done)
+		fn(cache)
+	}
+
+	select {
+	case <-d.done:
+		return ErrDoppelShutdown
+	case <-ctx.Done():
+		return ctx.Err()
+	case d.opStream <- wrapped:
+	}
+
+	<-done // wrapped always runs to completion once accepted
+	return nil
+}
+
+// EntryState describes the status of a cache entry at the time of a snapshot.
+type EntryState string
+
+// The states a cache entry may occupy.
+const (
+	StateParsing EntryState = "parsing" // parse in progress or awaiting retry
+	StateReady   EntryState = "ready"   // parsed successfully
+	StateError   EntryState = "error"   // parsing failed and the error is cached
+)
+
+// A CacheSnapshot is a point-in-time view of a Doppel's cache, intended for
+// debugging. It is safe to marshal as JSON.
+type CacheSnapshot struct {
+	TakenAt time.Time       `json:"takenAt"`
+	Entries []EntrySnapshot `json:"entries"` // sorted by name
+}
+
+// An EntrySnapshot describes a single cache entry.
+type EntrySnapshot struct {
+	Name         string     `json:"name"`
+	State        EntryState `json:"state"`
+	Error        string     `json:"error,omitempty"`
+	ParsedAt     *time.Time `json:"parsedAt,omitempty"`  // nil unless ready
+	ErroredAt    *time.Time `json:"erroredAt,omitempty"` // nil unless in error
+	Deliveries   uint64     `json:"deliveries"`
+	BaseTmplName string     `json:"baseTmplName,omitempty"`
+	Filepaths    []string   `json:"filepaths"`
+	Aliases      []string   `json:"aliases,omitempty"` // names registered via RegisterAlias that share the entry
+
+	// Metrics of the most recent parse, for finding slow or heavy templates.
+	// They are zero while the entry is parsing, and the file count and bytes
+	// read are zero if it failed. Base templates cloned from other entries
+	// count towards those entries rather than this one.
+	ParseDuration time.Duration `json:"parseDuration,omitempty"` // includes time spent retrieving the base template
+	FilesParsed   int           `json:"filesParsed,omitempty"`
+	BytesRead     int64         `json:"bytesRead,omitempty"`
+
+	takenAt time.Time
+}
+
+// Age returns the time elapsed between the entry being parsed, or failing to
+// parse, and the snapshot being taken. It returns zero for entries that are
+// still parsing.
+func (es EntrySnapshot) Age() time.Duration {
+	switch es.State {
+	case StateReady:
+		return es.takenAt.Sub(*es.ParsedAt)
+	case StateError:
+		return es.takenAt.Sub(*es.ErroredAt)
+	}
+	return 0
+}
+
+// Snapshot returns a CacheSnapshot describing every entry in the cache. The
+// snapshot is collected by the cache goroutine, and entries that are still
+// parsing are reported as such without waiting for them to complete.
+func (d *Doppel) Snapshot(ctx context.Context) (CacheSnapshot, error) {
+	var snap CacheSnapshot
+	err := d.do(ctx, func(cache map[string]*cacheEntry) {
+		snap.TakenAt = d.clock.Now()
+		snap.Entries = make([]EntrySnapshot, 0, len(cache))
+		aliases := d.aliasesOf()
+		for name, ce := range cache {
+			es := ce.snapshot(name)
+			es.takenAt = snap.TakenAt
+			if name == ce.name {
+				es.Aliases = aliases[name]
+			}
+			snap.Entries = append(snap.Entries, es)
+		}
+	})
+	if err != nil {
+		return CacheSnapshot{}, err
+	}
+
+	sort.Slice(snap.Entries, func(i, j int) bool {
+		return snap.Entries[i].Name < snap.Entries[j].Name
+	})
+	return snap, nil
+}
+
+// ParseErrors returns the error of every cache entry whose most recent parse
+// failed, keyed by the name under which it is cached; locale variants are
+// keyed as for EntrySnapshot. Entries awaiting a retry are included with the
+// error of their last attempt. The errors are those cached for each entry,
+// which Get wraps, so their chains may be inspected with errors.Is and
+// errors.As.
+//
+// The entries are collected by the cache goroutine without waiting for parses
+// in progress.
+func (d *Doppel) ParseErrors(ctx context.Context) (map[string]error, error) {
+	errs := make(map[string]error)
+	err := d.do(ctx, func(cache map[string]*cacheEntry) {
+		for key, ce := range cache {
+			if err := ce.lastErr.get(); err != nil {
+				errs[key] = err
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// A HealthReport summarizes the state of a Doppel's cache. It is safe to
+// marshal as JSON.
+type HealthReport struct {
+	Running bool     `json:"running"`
+	Entries int      `json:"entries"` // templates cached or being parsed, including errors
+	Errors  []string `json:"errors"`  // names of entries whose parse failed, sorted
+}
+
+// Health returns a HealthReport for the cache, suitable for health-check
+// endpoints. Unlike Snapshot, Health describes entries individually only if
+// they are in error, so it is cheap enough to call frequently. If the cache has
+// shut down, Health reports that it isn't running and nothing else.
+func (d *Doppel) Health() HealthReport {
+	report := HealthReport{Errors: []string{}}
+	err := d.do(context.Background(), func(cache map[string]*cacheEntry) {
+		report.Entries = len(cache)
+		for key, ce := range cache {
+			select {
+			case <-ce.ready:
+				if ce.err != nil {
+					report.Errors = append(report.Errors, key)
+				}
+			default:
+			}
+		}
+	})
+	if err != nil {
+		return HealthReport{Errors: []string{}}
+	}
+
+	report.Running = true
+	sort.Strings(report.Errors)
+	return report
+}
+
+// InFlight returns the names of the cache entries still being parsed, or
+// awaiting a retry, in sorted order; locale variants are named as for
+// EntrySnapshot. It is intended for diagnosing parses that hang, e.g. on slow
+// I/O. InFlight returns nil if the Doppel has shut down.
+func (d *Doppel) InFlight() []string {
+	var names []string
+	err := d.do(context.Background(), func(cache map[string]*cacheEntry) {
+		names = []string{}
+		for key, ce := range cache {
+			select {
+			case <-ce.ready:
+			default:
+				names = append(names, key)
+			}
+		}
+	})
+	if err != nil {
+		return nil
+	}
+	sort.Strings(names)
+	return names
+}
+
+// snapshot describes the cacheEntry without blocking. Fields written by parse
+// are only read once ready is closed, at which point they are immutable.
+func (ce *cacheEntry) snapshot(name string) EntrySnapshot {
+	es := EntrySnapshot{
+		Name:       name,
+		State:      StateParsing,
+		Deliveries: atomic.LoadUint64(&ce.deliveries),
+		Filepaths:  []string{},
+	}
+	if ce.schematic != nil {
+		es.BaseTmplName = ce.schematic.BaseTmplName
+		es.Filepaths = append(es.Filepaths, ce.schematic.Filepaths...)
+	}
+
+	select {
+	case <-ce.ready:
+	default:
+		return es
+	}
+
+	es.ParseDuration = ce.parseTime
+	es.FilesParsed = ce.filesParsed
+	es.BytesRead = ce.size
+	if ce.err != nil {
+		es.State = StateError
+		es.Error = ce.err.Error()
+		erroredAt := ce.erroredAt
+		es.ErroredAt = &erroredAt
+	} else {
+		es.State = StateReady
+		parsedAt := ce.parsedAt
+		es.ParsedAt = &parsedAt
+	}
+	return es
+}
+
+// SchematicSnapshot returns a deep copy of the CacheSchematic currently in use
+// by the cache. Together with RestoreSchematic, it allows tests to modify a
+// live Doppel's schematic and later return it to its original state.
+func (d *Doppel) SchematicSnapshot(ctx context.Context) (CacheSchematic, error) {
+	var cs CacheSchematic
+	err := d.do(ctx, func(map[string]*cacheEntry) {
+		cs = d.schematic.Clone()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// SchematicFor returns a deep copy of the named TemplateSchematic currently in
+// use by the cache, and whether it exists. It is a cheaper alternative to
+// SchematicSnapshot when only a single entry is of interest. SchematicFor
+// returns false if the Doppel has shut down.
+func (d *Doppel) SchematicFor(name string) (*TemplateSchematic, bool) {
+	name = d.canonical(name)
+	var ts *TemplateSchematic
+	err := d.do(context.Background(), func(map[string]*cacheEntry) {
+		ts = d.schematic[name].Clone()
+	})
+	if err != nil || ts == nil {
+		return nil, false
+	}
+	return ts, true
+}
+
+// FilesFor behaves like CacheSchematic.FilesFor for the CacheSchematic
+// currently in use by the cache, in which references to partial groups have
+// been expanded. Templates stored via Inject have no files. FilesFor returns
+// ErrDoppelShutdown if the Doppel has shut down.
+func (d *Doppel) FilesFor(name string) ([]string, error) {
+	name = d.canonical(name)
+	var (
+		files []string
+		err   error
+	)
+	if doErr := d.do(context.Background(), func(map[string]*cacheEntry) {
+		files, err = d.schematic.FilesFor(name)
+	}); doErr != nil {
+		return nil, doErr
+	}
+	return files, err
+}
+
+// RestoreSchematic replaces the CacheSchematic in use by the cache with a deep
+// copy of cs, with references to partial groups expanded, and evicts every
+// cached template and rendered output, so that subsequent requests are parsed
+// according to the new schematic. Templates stored via Inject are discarded.
+// Requests already in progress are unaffected.
+func (d *Doppel) RestoreSchematic(ctx context.Context, cs CacheSchematic) error {
+	if cyclic, err := IsCyclic(cs); cyclic {
+		return err
+	}
+	cs, err := cs.expandGroups(d.partialGroups) // a deep copy
+	if err != nil {
+		return err
+	}
+	if d.normalizeName != nil {
+		if cs, err = cs.normalized(d.normalizeName); err != nil {
+			return err
+		}
+	}
+	if d.sortFilepaths {
+		cs.sortFilepaths()
+	}
+	if err := cs.validate(d.allowEmptySchematic); err != nil {
+		return err
+	}
+	for _, name := range cs.unusedInternal() {
+		d.log.Printf(logInternalUnused, name)
+	}
+
+	return d.do(ctx, func(cache map[string]*cacheEntry) {
+		d.schematic = cs
+		d.storeLoaders(cs)
+		d.pruneAliases()
+		d.injected = nil
+		for name := range cs {
+			if d.stats[name] == nil {
+				d.stats[name] = &templateStats{}
+			}
+		}
+		for key := range cache {
+			d.deleteEntry(cache, key)
+			d.emit(EventEvict, key)
+		}
+		if d.renders != nil {
+			d.renders.purge()
+		}
+	})
+}
@@ -0,0 +1,486 @@
+package doppel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Run("describes each cache entry", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		testSchematic := schematic.Clone()
+		testSchematic["error"] = &TemplateSchematic{Filepaths: []string{"missing"}}
+		d, err := New(ctx, testSchematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"withBody1", "withBody1", "error"} {
+			d.Get(context.Background(), name)
+		}
+		// Simulate an entry that is mid-parse.
+		err = d.do(context.Background(), func(cache map[string]*cacheEntry) {
+			cache["parsing"] = &cacheEntry{ready: make(chan struct{})}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		snap, err := d.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]struct {
+			state      EntryState
+			deliveries uint64
+			hasError   bool
+		}{
+			"base":      {StateReady, 1, false},
+			"commonNav": {StateReady, 1, false},
+			"error":     {StateError, 1, true},
+			"parsing":   {StateParsing, 0, false},
+			"withBody1": {StateReady, 2, false},
+		}
+		if len(snap.Entries) != len(want) {
+			t.Fatalf("got %d entries, want %d", len(snap.Entries), len(want))
+		}
+		for i, es := range snap.Entries {
+			if i > 0 && snap.Entries[i-1].Name > es.Name {
+				t.Errorf("entries are not sorted by name")
+			}
+			w, ok := want[es.Name]
+			if !ok {
+				t.Errorf("unexpected entry %q", es.Name)
+				continue
+			}
+			if es.State != w.state {
+				t.Errorf("%s: got state %q, want %q", es.Name, es.State, w.state)
+			}
+			if es.Deliveries != w.deliveries {
+				t.Errorf("%s: got %d deliveries, want %d", es.Name, es.Deliveries, w.deliveries)
+			}
+			if gotErr := es.Error != ""; gotErr != w.hasError {
+				t.Errorf("%s: got error %q, want error: %t", es.Name, es.Error, w.hasError)
+			}
+			if gotParsed := es.ParsedAt != nil; gotParsed != (es.State == StateReady) {
+				t.Errorf("%s: got ParsedAt %v in state %q", es.Name, es.ParsedAt, es.State)
+			}
+			if gotErrored := es.ErroredAt != nil; gotErrored != (es.State == StateError) {
+				t.Errorf("%s: got ErroredAt %v in state %q", es.Name, es.ErroredAt, es.State)
+			}
+
+			b, err := json.Marshal(es)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(b, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := fields["parsedAt"]; ok != (es.State == StateReady) {
+				t.Errorf("%s: marshalled parsedAt in state %q: %s", es.Name, es.State, b)
+			}
+			if _, ok := fields["erroredAt"]; ok != (es.State == StateError) {
+				t.Errorf("%s: marshalled erroredAt in state %q: %s", es.Name, es.State, b)
+			}
+		}
+	})
+
+	t.Run("reports entry ages", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		clk := newFakeClock()
+		testSchematic := schematic.Clone()
+		testSchematic["error"] = &TemplateSchematic{Filepaths: []string{"missing"}}
+		d, err := New(ctx, testSchematic, WithClock(clk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Get(context.Background(), "base")
+		d.Get(context.Background(), "error")
+
+		const elapsed = 5 * time.Minute
+		clk.Advance(elapsed)
+		snap, err := d.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, es := range snap.Entries {
+			if age := es.Age(); age != elapsed {
+				t.Errorf("%s: got age %v, want %v", es.Name, age, elapsed)
+			}
+		}
+	})
+
+	t.Run("reports parse metrics", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		testSchematic := schematic.Clone()
+		testSchematic["error"] = &TemplateSchematic{Filepaths: []string{"missing"}}
+		d, err := New(ctx, testSchematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Get(context.Background(), "withBody1")
+		d.Get(context.Background(), "error")
+
+		snap, err := d.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wantFiles := map[string]string{"base": basepath, "commonNav": navpath, "withBody1": body1Path}
+		for _, es := range snap.Entries {
+			if es.ParseDuration <= 0 {
+				t.Errorf("%s: parse duration was not recorded", es.Name)
+			}
+			var wantBytes int64
+			var wantCount int
+			if path, ok := wantFiles[es.Name]; ok {
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantBytes, wantCount = info.Size(), 1
+			}
+			if es.FilesParsed != wantCount || es.BytesRead != wantBytes {
+				t.Errorf("%s: got %d files, %d bytes; want %d, %d",
+					es.Name, es.FilesParsed, es.BytesRead, wantCount, wantBytes)
+			}
+		}
+	})
+
+	t.Run("is safe to marshal as JSON", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Get(context.Background(), "withBody2")
+
+		snap, err := d.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := json.Marshal(snap); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("returns ErrDoppelShutdown if the cache is closed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+
+		if _, err := d.Snapshot(context.Background()); err != ErrDoppelShutdown {
+			t.Errorf("got error %v, want ErrDoppelShutdown", err)
+		}
+	})
+}
+
+func TestHealth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d, err := New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"missing2", "missing1"} {
+		if _, err := d.Get(context.Background(), name); !errors.Is(err, ErrSchematicNotFound) {
+			t.Fatalf("got error %v, want ErrSchematicNotFound", err)
+		}
+	}
+
+	want := HealthReport{Running: true, Entries: 5, Errors: []string{"missing1", "missing2"}}
+	if got := d.Health(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	cancel()
+	for range d.Heartbeat() {
+	}
+	want = HealthReport{Errors: []string{}}
+	if got := d.Health(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after shutdown: got %+v, want %+v", got, want)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	hungOpen := OptionFunc(func(d *Doppel) {
+		d.open = func(path string) (io.ReadCloser, error) {
+			if path == basepath {
+				return &slowReader{release}, nil
+			}
+			return openFile(path)
+		}
+	})
+	d, err := New(ctx, schematic, hungOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.InFlight(); len(got) != 0 {
+		t.Errorf("got %v in flight before any request, want none", got)
+	}
+
+	errStream := make(chan error)
+	go func() {
+		_, err := d.Get(context.Background(), "withBody1")
+		errStream <- err
+	}()
+	want := []string{"base", "commonNav", "withBody1"}
+	waitFor(t, func() bool { return reflect.DeepEqual(d.InFlight(), want) })
+
+	close(release)
+	<-errStream // base reads as empty, so the outcome is unimportant
+	if got := d.InFlight(); len(got) != 0 {
+		t.Errorf("got %v in flight after parsing completed, want none", got)
+	}
+
+	cancel()
+	for range d.Heartbeat() {
+	}
+	if got := d.InFlight(); got != nil {
+		t.Errorf("got %v after shutdown, want nil", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testSchematic := schematic.Clone()
+	testSchematic["unreadable"] = &TemplateSchematic{Filepaths: []string{"missing"}}
+	d, err := New(ctx, testSchematic, WithRetryTimeouts())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"withBody1", "unreadable", "missing"} {
+		d.Get(context.Background(), name)
+	}
+	// Simulate an entry awaiting a retry after its last parse timed out.
+	err = d.do(context.Background(), func(cache map[string]*cacheEntry) {
+		ce := &cacheEntry{ready: make(chan struct{}), retry: make(chan struct{}, 1)}
+		ce.lastErr.set(context.DeadlineExceeded)
+		cache["retrying"] = ce
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, err := d.ParseErrors(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]error{
+		"unreadable": os.ErrNotExist,
+		"missing":    ErrSchematicNotFound,
+		"retrying":   context.DeadlineExceeded,
+	}
+	if len(errs) != len(want) {
+		t.Errorf("got errors for %d entries, want %d: %v", len(errs), len(want), errs)
+	}
+	for name, target := range want {
+		if !errors.Is(errs[name], target) {
+			t.Errorf("%s: got error %v, want %v", name, errs[name], target)
+		}
+	}
+
+	t.Run("returns ErrDoppelShutdown if the cache is closed", func(t *testing.T) {
+		cancel()
+		for range d.Heartbeat() {
+			// Drain until the cache goroutine exits and closes the channel.
+		}
+		if _, err := d.ParseErrors(context.Background()); err != ErrDoppelShutdown {
+			t.Errorf("got error %v, want ErrDoppelShutdown", err)
+		}
+	})
+}
+
+func TestSchematicSnapshot(t *testing.T) {
+	t.Run("returns a deep copy of the live schematic", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		snap, err := d.SchematicSnapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snap) != len(schematic) {
+			t.Fatalf("got %d entries, want %d", len(snap), len(schematic))
+		}
+
+		snap["base"].Filepaths[0] = "modified"
+		again, err := d.SchematicSnapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again["base"].Filepaths[0] != basepath {
+			t.Error("snapshot shares memory with the live schematic")
+		}
+	})
+}
+
+func TestSchematicFor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("returns a deep copy of the named entry", func(t *testing.T) {
+		ts, ok := d.SchematicFor("withBody1")
+		if !ok {
+			t.Fatal("entry not found")
+		}
+		if ts.BaseTmplName != schematic["withBody1"].BaseTmplName {
+			t.Errorf("got base %q, want %q", ts.BaseTmplName, schematic["withBody1"].BaseTmplName)
+		}
+
+		ts.Filepaths[0] = "modified"
+		again, _ := d.SchematicFor("withBody1")
+		if again.Filepaths[0] == "modified" {
+			t.Error("returned entry shares memory with the live schematic")
+		}
+	})
+
+	t.Run("reports missing entries", func(t *testing.T) {
+		if ts, ok := d.SchematicFor("missing"); ok || ts != nil {
+			t.Errorf("got (%+v, %t), want (nil, false)", ts, ok)
+		}
+	})
+}
+
+func TestFilesFor(t *testing.T) {
+	grouped := schematic.Clone()
+	grouped["withBody1"].Filepaths = []string{"@body", navpath}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := New(ctx, grouped, WithPartialGroup("body", []string{body1Path}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("expands partial groups", func(t *testing.T) {
+		got, err := d.FilesFor("withBody1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{basepath, navpath, body1Path}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("returns ErrSchematicNotFound for missing entries", func(t *testing.T) {
+		if _, err := d.FilesFor("missing"); !errors.Is(err, ErrSchematicNotFound) {
+			t.Errorf("got error %v, want ErrSchematicNotFound", err)
+		}
+	})
+
+	t.Run("returns ErrDoppelShutdown after shutdown", func(t *testing.T) {
+		cancel()
+		for range d.Heartbeat() {
+		}
+		if _, err := d.FilesFor("withBody1"); !errors.Is(err, ErrDoppelShutdown) {
+			t.Errorf("got error %v, want ErrDoppelShutdown", err)
+		}
+	})
+}
+
+func TestRestoreSchematic(t *testing.T) {
+	t.Run("replaces the live schematic and evicts cached templates", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		original, err := d.SchematicSnapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		modified := original.Clone()
+		delete(modified, "withBody2")
+		modified["withBody1"].Filepaths = []string{body2Path}
+		if err := d.RestoreSchematic(context.Background(), modified); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := d.Get(context.Background(), "withBody2"); err == nil {
+			t.Error("removed entry was still served")
+		}
+		tmpl, err := d.Get(context.Background(), "withBody1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tmpl.Lookup("body_2.gohtml") == nil {
+			t.Error("modified entry was not reparsed")
+		}
+
+		if err := d.RestoreSchematic(context.Background(), original); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Get(context.Background(), "withBody2"); err != nil {
+			t.Errorf("restored entry was not served: %v", err)
+		}
+		tmpl, err = d.Get(context.Background(), "withBody1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tmpl.Lookup("body_1.gohtml") == nil {
+			t.Error("restored entry was not reparsed")
+		}
+	})
+
+	t.Run("rejects cyclic schematics", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cyclic := schematic.Clone()
+		cyclic["base"].BaseTmplName = "withBody1"
+		if err := d.RestoreSchematic(context.Background(), cyclic); err == nil {
+			t.Error("failed to report cycle in schematic")
+		}
+	})
+}
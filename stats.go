@@ -0,0 +1,136 @@
+package doppel
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// TemplateStats describes the cache's activity for a single template.
+type TemplateStats struct {
+	Hits               uint64        `json:"hits"`               // requests served from the cache
+	Misses             uint64        `json:"misses"`             // requests that triggered a parse
+	Parses             uint64        `json:"parses"`             // parse attempts, including retries
+	ParseFailures      uint64        `json:"parseFailures"`      // parse attempts that ended in error
+	AvgParseDuration   time.Duration `json:"avgParseDuration"`   // includes time spent retrieving the base template
+	MaxParseDuration   time.Duration `json:"maxParseDuration"`   // the slowest parse attempt
+	TotalParseDuration time.Duration `json:"totalParseDuration"` // the sum over all parse attempts
+	LastDelivered      time.Time     `json:"lastDelivered"`      // zero if never delivered
+}
+
+// templateStats accumulates TemplateStats. Fields updated outside the cache
+// goroutine are accessed atomically and must stay 64-bit aligned.
+type templateStats struct {
+	parses        uint64
+	parseFailures uint64
+	parseNanos    uint64 // total parse duration
+	maxParseNanos uint64 // longest parse duration
+	lastDelivered int64  // Unix nanoseconds
+	hits          uint64 // incremented outside the cache goroutine by BackendLocked
+
+	// Owned by the cache goroutine.
+	misses uint64
+}
+
+// newStats preallocates stats for every template in cs so that recording
+// statistics doesn't allocate.
+func newStats(cs CacheSchematic) map[string]*templateStats {
+	stats := make(map[string]*templateStats, len(cs))
+	for name := range cs {
+		stats[name] = &templateStats{}
+	}
+	return stats
+}
+
+func (ts *templateStats) recordParse(duration time.Duration, err error) {
+	if ts == nil {
+		return
+	}
+	atomic.AddUint64(&ts.parses, 1)
+	atomic.AddUint64(&ts.parseNanos, uint64(duration))
+	for {
+		max := atomic.LoadUint64(&ts.maxParseNanos)
+		if uint64(duration) <= max || atomic.CompareAndSwapUint64(&ts.maxParseNanos, max, uint64(duration)) {
+			break
+		}
+	}
+	if err != nil {
+		atomic.AddUint64(&ts.parseFailures, 1)
+	}
+}
+
+func (ts *templateStats) recordDelivery(at time.Time) {
+	if ts == nil {
+		return
+	}
+	atomic.StoreInt64(&ts.lastDelivered, at.UnixNano())
+}
+
+func (ts *templateStats) export() TemplateStats {
+	stats := TemplateStats{
+		Hits:          atomic.LoadUint64(&ts.hits),
+		Misses:        ts.misses,
+		Parses:        atomic.LoadUint64(&ts.parses),
+		ParseFailures: atomic.LoadUint64(&ts.parseFailures),
+	}
+	if stats.Parses > 0 {
+		stats.TotalParseDuration = time.Duration(atomic.LoadUint64(&ts.parseNanos))
+		stats.AvgParseDuration = stats.TotalParseDuration / time.Duration(stats.Parses)
+		stats.MaxParseDuration = time.Duration(atomic.LoadUint64(&ts.maxParseNanos))
+	}
+	if nanos := atomic.LoadInt64(&ts.lastDelivered); nanos > 0 {
+		stats.LastDelivered = time.Unix(0, nanos)
+	}
+	return stats
+}
+
+// TemplateStats returns statistics for each template in the Doppel's
+// schematic, keyed by name. Requests for locale variants are attributed to the
+// template they are composed from.
+func (d *Doppel) TemplateStats(ctx context.Context) (map[string]TemplateStats, error) {
+	var stats map[string]TemplateStats
+	err := d.do(ctx, func(map[string]*cacheEntry) {
+		stats = make(map[string]TemplateStats, len(d.stats))
+		for name, ts := range d.stats {
+			stats[name] = ts.export()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Stats summarizes the contents of a Doppel's cache.
+type Stats struct {
+	Entries int `json:"entries"` // templates cached or being parsed, including errors
+
+	// BytesUsed estimates the memory used by the cache as the total size of
+	// the source files read to parse each template currently cached. It is
+	// approximate: it doesn't account for the size of the parsed templates or
+	// for Go runtime overhead, and excludes templates that are still parsing
+	// or failed to parse.
+	BytesUsed int64 `json:"bytesUsed"`
+}
+
+// Stats returns a summary of the cache's contents, collected by the cache
+// goroutine without waiting for parses in progress.
+func (d *Doppel) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	err := d.do(ctx, func(cache map[string]*cacheEntry) {
+		stats.Entries = len(cache)
+		for _, ce := range cache {
+			select {
+			case <-ce.ready:
+				if ce.err == nil {
+					stats.BytesUsed += ce.size
+				}
+			default:
+			}
+		}
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	return stats, nil
+}
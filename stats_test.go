@@ -0,0 +1,169 @@
+package doppel
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestTemplateStats(t *testing.T) {
+	t.Run("counts hits, misses and parses per template", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		stats, err := d.TemplateStats(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats) != len(schematic) {
+			t.Errorf("got stats for %d templates, want %d", len(stats), len(schematic))
+		}
+
+		want := map[string]struct{ hits, misses, parses uint64 }{
+			"base":      {0, 1, 1},
+			"commonNav": {0, 1, 1},
+			"withBody1": {1, 1, 1},
+			"withBody2": {0, 0, 0},
+		}
+		for name, w := range want {
+			got := stats[name]
+			if got.Hits != w.hits || got.Misses != w.misses || got.Parses != w.parses {
+				t.Errorf("%s: got %d hits, %d misses, %d parses; want %d, %d, %d",
+					name, got.Hits, got.Misses, got.Parses, w.hits, w.misses, w.parses)
+			}
+			if got.ParseFailures != 0 {
+				t.Errorf("%s: got %d parse failures, want 0", name, got.ParseFailures)
+			}
+			if delivered := !got.LastDelivered.IsZero(); delivered != (w.parses > 0) {
+				t.Errorf("%s: got LastDelivered %v", name, got.LastDelivered)
+			}
+		}
+		if stats["withBody1"].AvgParseDuration <= 0 {
+			t.Error("parse duration was not recorded")
+		}
+	})
+
+	t.Run("accumulates parse durations", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var prev TemplateStats
+		for i := 0; i < 3; i++ {
+			if _, err := d.Get(context.Background(), "base"); err != nil {
+				t.Fatal(err)
+			}
+			stats, err := d.TemplateStats(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := stats["base"]
+			if got.MaxParseDuration <= 0 || got.MaxParseDuration < prev.MaxParseDuration {
+				t.Errorf("parse %d: got MaxParseDuration %v after %v", i, got.MaxParseDuration, prev.MaxParseDuration)
+			}
+			if got.TotalParseDuration <= prev.TotalParseDuration || got.TotalParseDuration < got.MaxParseDuration {
+				t.Errorf("parse %d: got TotalParseDuration %v after %v, with max %v",
+					i, got.TotalParseDuration, prev.TotalParseDuration, got.MaxParseDuration)
+			}
+			prev = got
+		}
+	})
+
+	t.Run("counts parse failures", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		testSchematic := schematic.Clone()
+		testSchematic["error"] = &TemplateSchematic{Filepaths: []string{"missing"}}
+		d, err := New(ctx, testSchematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Get(context.Background(), "error")
+
+		stats, err := d.TemplateStats(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := stats["error"].ParseFailures; got != 1 {
+			t.Errorf("got %d parse failures, want 1", got)
+		}
+	})
+
+	t.Run("does not track templates absent from the schematic", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Get(context.Background(), "unknown")
+
+		stats, err := d.TemplateStats(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := stats["unknown"]; ok {
+			t.Error("got stats for unknown template")
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testSchematic := schematic.Clone()
+	testSchematic["error"] = &TemplateSchematic{Filepaths: []string{"missing"}}
+	d, err := New(ctx, testSchematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := d.Stats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{}) {
+		t.Errorf("got %+v for empty cache, want zero Stats", stats)
+	}
+
+	if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+		t.Fatal(err)
+	}
+	d.Get(context.Background(), "error")
+
+	var want int64
+	for _, path := range []string{basepath, navpath, body1Path} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want += info.Size()
+	}
+
+	stats, err = d.Stats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 4 {
+		t.Errorf("got %d entries, want 4", stats.Entries)
+	}
+	if stats.BytesUsed != want {
+		t.Errorf("got %d bytes used, want %d", stats.BytesUsed, want)
+	}
+}
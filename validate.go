@@ -0,0 +1,65 @@
+package doppel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ValidateSchematic checks cs for mistakes without parsing any templates,
+// making it suitable for checking configuration in CI. It reports nil entries,
+// files listed more than once, base templates and includes absent from cs, and
+// cycles. If baseDir is non-empty, it also reports template files that don't
+// exist, resolving relative paths against baseDir; references to partial
+// groups are not checked.
+//
+// Unlike New, ValidateSchematic reports every problem it finds, aggregated
+// into a single error matching ErrInvalidSchematic that lists each problem on
+// its own line. Problems concerning missing templates also match
+// ErrSchematicNotFound.
+func ValidateSchematic(cs CacheSchematic, baseDir string) error {
+	var problems []error
+	for _, name := range cs.names() {
+		ts := cs[name]
+		if ts == nil {
+			problems = append(problems, fmt.Errorf("%s: %w", name, ErrNilTemplateSchematic))
+			continue
+		}
+		if ts.BaseTmplName != "" && cs[ts.BaseTmplName] == nil {
+			problems = append(problems, fmt.Errorf("%s: base %q: %w", name, ts.BaseTmplName, ErrSchematicNotFound))
+		}
+		for _, inc := range ts.Includes {
+			if cs[inc] == nil {
+				problems = append(problems, fmt.Errorf("%s: include %q: %w", name, inc, ErrSchematicNotFound))
+			}
+		}
+
+		seen := make(map[string]bool, len(ts.Filepaths))
+		for _, path := range ts.Filepaths {
+			if seen[path] {
+				problems = append(problems, fmt.Errorf("%s: %s: %w", name, path, ErrDuplicateFilepath))
+				continue
+			}
+			seen[path] = true
+			if baseDir == "" || strings.HasPrefix(path, partialGroupPrefix) {
+				continue
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(baseDir, path)
+			}
+			if _, err := os.Stat(path); err != nil {
+				problems = append(problems, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	if cyclic, err := IsCyclic(cs); cyclic {
+		problems = append(problems, err)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidSchematic, errors.Join(problems...))
+}
@@ -0,0 +1,48 @@
+package doppel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateSchematic(t *testing.T) {
+	t.Run("accepts a valid schematic", func(t *testing.T) {
+		if err := ValidateSchematic(schematic, "/"); err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+	})
+
+	t.Run("reports every problem", func(t *testing.T) {
+		cs := CacheSchematic{
+			"nil":      nil,
+			"orphan":   {BaseTmplName: "missing", Filepaths: []string{basepath}},
+			"includer": {Filepaths: []string{basepath}, Includes: []string{"absent"}},
+			"dupe":     {Filepaths: []string{basepath, basepath}},
+			"nofile":   {Filepaths: []string{"does_not_exist.gohtml", "@group"}},
+			"a":        {BaseTmplName: "b"},
+			"b":        {BaseTmplName: "a"},
+		}
+		err := ValidateSchematic(cs, fixtures)
+		for _, target := range []error{ErrInvalidSchematic, ErrNilTemplateSchematic, ErrSchematicNotFound, ErrDuplicateFilepath} {
+			if !errors.Is(err, target) {
+				t.Errorf("error doesn't match %v: %v", target, err)
+			}
+		}
+		for _, want := range []string{`base "missing"`, `include "absent"`, "does_not_exist.gohtml", "cycle through"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error doesn't mention %s: %v", want, err)
+			}
+		}
+		if strings.Contains(err.Error(), "@group") {
+			t.Errorf("error reports partial group reference: %v", err)
+		}
+	})
+
+	t.Run("checks files only given a base directory", func(t *testing.T) {
+		cs := CacheSchematic{"nofile": {Filepaths: []string{"does_not_exist.gohtml"}}}
+		if err := ValidateSchematic(cs, ""); err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+	})
+}
@@ -0,0 +1,286 @@
+package doppel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WarmProgress reports the outcome of parsing a single template during a
+// warm-up started by Warm.
+type WarmProgress struct {
+	Name      string
+	Err       error // the error Get would return for Name, if any
+	Completed int   // templates finished so far, including Name
+	Total     int   // templates to be warmed, including shared base templates
+}
+
+// Warm parses the named templates, and the base templates they are composed
+// from, into the cache in the background, reporting each template's outcome
+// on the returned channel as it finishes. Base templates shared by several
+// names are parsed and reported once, and before the templates composed from
+// them where possible; internal base templates are parsed with, and not
+// reported separately from, the first template composed from them. Up to
+// GOMAXPROCS templates are parsed at a time.
+//
+// The channel is buffered to hold every report, so it needn't be read, and is
+// closed when every template has finished or ctx is done, whichever is first.
+// Once it is closed, WarmErr returns the aggregate error of the warm-up.
+//
+// Warm returns an error without starting if ctx is done or the cache has shut
+// down.
+func (d *Doppel) Warm(ctx context.Context, names []string, opts ...WarmOption) (<-chan WarmProgress, error) {
+	w := &warmup{d: d}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	var queue []string
+	depth := make(map[string]int)
+	err := d.do(ctx, func(cache map[string]*cacheEntry) {
+		for _, name := range names {
+			name = d.canonical(name)
+			for next := name; next != ""; {
+				if _, ok := depth[next]; ok {
+					break
+				}
+				depth[next] = d.schematic.depth(next)
+				if _, ok := cache[next]; !ok {
+					w.uncached = append(w.uncached, next)
+				}
+				ts := d.schematic[next]
+				// Internal bases can't be requested directly, so they are
+				// parsed along with the first template composed from them.
+				if next == name || ts == nil || !ts.Internal {
+					queue = append(queue, next)
+				}
+				if ts != nil {
+					next = ts.BaseTmplName
+				} else {
+					next = ""
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Parse base templates first, so that templates composed from them find
+	// them cached.
+	sort.Slice(queue, func(i, j int) bool {
+		if depth[queue[i]] != depth[queue[j]] {
+			return depth[queue[i]] < depth[queue[j]]
+		}
+		return queue[i] < queue[j]
+	})
+
+	progress := make(chan WarmProgress, len(queue))
+	w.progress, w.total = progress, len(queue)
+	go w.run(ctx, queue)
+	return progress, nil
+}
+
+// A WarmOption configures a warm-up started by Warm.
+type WarmOption func(*warmup)
+
+// ValidateOnly returns a WarmOption that discards the templates parsed by the
+// warm-up once it finishes, so that startup can fail fast if any template
+// doesn't compile without keeping every template resident in memory. Discarded
+// templates are parsed again when next requested. Templates that were already
+// cached when the warm-up started are kept.
+func ValidateOnly() WarmOption {
+	return func(w *warmup) {
+		w.validateOnly = true
+	}
+}
+
+// WarmErr returns the aggregate error of the most recent warm-up started by
+// Warm to have finished, or nil if it succeeded or none has finished. The error
+// matches ErrWarmFailed, lists each template that failed and, if the warm-up
+// was cut short, matches ctx's error via errors.Is.
+func (d *Doppel) WarmErr() error {
+	d.warmMu.Lock()
+	defer d.warmMu.Unlock()
+	return d.warmErr
+}
+
+// A warmup tracks the progress of a single call to Warm.
+type warmup struct {
+	d        *Doppel
+	progress chan<- WarmProgress
+
+	mu        sync.Mutex // serializes reports so that Completed increases monotonically
+	total     int
+	completed int
+	failed    []error
+
+	validateOnly bool     // flags whether to discard the templates parsed by the warm-up
+	uncached     []string // templates absent from the cache when the warm-up started
+}
+
+// run parses the templates in queue with bounded concurrency, closing the
+// progress channel once every worker has stopped.
+func (w *warmup) run(ctx context.Context, queue []string) {
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(queue) {
+		workers = len(queue)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				_, err := w.d.Get(ctx, name)
+				if ctx.Err() != nil {
+					return // unfinished templates aren't reported
+				}
+				w.report(name, err)
+			}
+		}()
+	}
+
+feed:
+	for _, name := range queue {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- name:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if w.validateOnly {
+		w.discard()
+	}
+
+	var aggregate error
+	if ctx.Err() != nil {
+		w.failed = append(w.failed, fmt.Errorf("warmed %d of %d templates: %w", w.completed, w.total, ctx.Err()))
+	}
+	if len(w.failed) > 0 {
+		aggregate = fmt.Errorf("%w: %w", ErrWarmFailed, errors.Join(w.failed...))
+	}
+	w.d.warmMu.Lock()
+	w.d.warmErr = aggregate
+	w.d.warmMu.Unlock()
+	close(w.progress)
+}
+
+// discard evicts the templates that were absent from the cache when the warm-up
+// started.
+func (w *warmup) discard() {
+	d := w.d
+	d.do(context.Background(), func(cache map[string]*cacheEntry) {
+		for _, name := range w.uncached {
+			if _, ok := cache[name]; ok {
+				d.deleteEntry(cache, name)
+				d.emit(EventEvict, name)
+			}
+		}
+	})
+}
+
+func (w *warmup) report(name string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.completed++
+	if err != nil {
+		w.failed = append(w.failed, fmt.Errorf("%s: %w", name, err))
+	}
+	w.progress <- WarmProgress{name, err, w.completed, w.total} // never blocks
+}
+
+// WarmFrom copies successfully parsed templates from old into d's cache,
+// sparing d the cost of reparsing them. A template is copied only if its
+// definition, and that of every template it is composed from, is identical in
+// both Doppels' schematics. Errors, locale variants and entries still being
+// parsed are not copied, nor are templates already present in d's cache.
+//
+// Copied templates are cloned, so the two caches never share mutable state.
+func (d *Doppel) WarmFrom(ctx context.Context, old *Doppel) error {
+	type warmEntry struct {
+		tmpl     *template.Template
+		parsedAt time.Time
+	}
+
+	var oldSchematic CacheSchematic
+	entries := make(map[string]warmEntry)
+	err := old.do(ctx, func(cache map[string]*cacheEntry) {
+		oldSchematic = old.schematic.Clone()
+		for key, ce := range cache {
+			if key != ce.name {
+				continue // locale variant
+			}
+
+			select {
+			case <-ce.ready:
+			default:
+				continue // still parsing
+			}
+
+			if ce.err != nil {
+				continue
+			}
+			clone, err := ce.tmpl.Clone()
+			if err != nil {
+				continue
+			}
+			entries[key] = warmEntry{clone, ce.parsedAt}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.do(ctx, func(cache map[string]*cacheEntry) {
+		for name, we := range entries {
+			if cache[name] != nil || !sameChain(d.schematic, oldSchematic, name) {
+				continue
+			}
+
+			d.log.Printf(logWarmingTemplate, name)
+			files, _ := d.schematic.filesFor(name)
+			entry := &cacheEntry{
+				name:      name,
+				ready:     make(chan struct{}),
+				retry:     make(chan struct{}, 1),
+				schematic: d.schematic[name].Clone(),
+				files:     files,
+				tmpl:      we.tmpl,
+				parsedAt:  we.parsedAt,
+			}
+			close(entry.ready)
+			d.storeEntry(cache, name, entry)
+		}
+	})
+}
+
+// sameChain reports whether the named template and every template it is
+// composed from, whether as a base or an include, are defined identically in a
+// and b.
+func sameChain(a, b CacheSchematic, name string) bool {
+	seen := map[string]bool{name: true} // guard against cycles
+	queue := []string{name}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		tsA, tsB := a[name], b[name]
+		if tsA == nil || tsB == nil || !tsA.equal(tsB) {
+			return false
+		}
+		for _, next := range a.edges(name) {
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return true
+}
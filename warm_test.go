@@ -0,0 +1,298 @@
+package doppel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWarmFrom(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	old, err := New(ctx, schematic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"withBody1", "withBody2"} {
+		if _, err := old.Get(context.Background(), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changed := schematic.Clone()
+	changed["withBody2"].Filepaths = []string{body1Path}
+	log := &testLogger{out: &bytes.Buffer{}}
+	d, err := New(ctx, changed, WithLogger(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.WarmFrom(context.Background(), old); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("serves unchanged templates without parsing", func(t *testing.T) {
+		for _, name := range []string{"base", "commonNav", "withBody1"} {
+			if _, err := d.Get(context.Background(), name); err != nil {
+				t.Fatal(err)
+			}
+			if msg := fmt.Sprintf(logParsingTemplate, name); strings.Contains(log.String(), msg) {
+				t.Errorf("%q was parsed, not copied", name)
+			}
+		}
+	})
+
+	t.Run("reparses changed templates", func(t *testing.T) {
+		tmpl, err := d.Get(context.Background(), "withBody2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg := fmt.Sprintf(logParsingTemplate, "withBody2"); !strings.Contains(log.String(), msg) {
+			t.Error("changed template was not reparsed")
+		}
+		if tmpl.Lookup("body_1.gohtml") == nil {
+			t.Error("changed template was not parsed from its new definition")
+		}
+	})
+}
+
+func TestSameChain(t *testing.T) {
+	changedBase := schematic.Clone()
+	changedBase["base"].Filepaths = []string{navpath}
+
+	testCases := []struct {
+		desc string
+		b    CacheSchematic
+		name string
+		want bool
+	}{
+		{"identical chains", schematic.Clone(), "withBody1", true},
+		{"changed base template", changedBase, "withBody1", false},
+		{"missing template", CacheSchematic{}, "withBody1", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := sameChain(schematic, tc.b, tc.name); got != tc.want {
+				t.Errorf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWarm(t *testing.T) {
+	// drain collects progress reports until the channel is closed.
+	drain := func(t *testing.T, progress <-chan WarmProgress) []WarmProgress {
+		t.Helper()
+		var reports []WarmProgress
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case p, ok := <-progress:
+				if !ok {
+					return reports
+				}
+				reports = append(reports, p)
+			case <-timeout:
+				t.Fatal("timed out waiting for warm-up to finish")
+			}
+		}
+	}
+
+	t.Run("reports each template once, bases first", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		rec := &eventRecorder{}
+		d, err := New(ctx, schematic, WithEventHook(rec.record))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		progress, err := d.Warm(context.Background(), []string{"withBody1", "withBody2", "withBody1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reports := drain(t, progress)
+
+		reported := make(map[string]int) // name to position
+		for i, p := range reports {
+			if p.Err != nil {
+				t.Errorf("%s: %v", p.Name, p.Err)
+			}
+			if p.Completed != i+1 || p.Total != 4 {
+				t.Errorf("report %d: got %d of %d complete, want %d of 4", i, p.Completed, p.Total, i+1)
+			}
+			if _, ok := reported[p.Name]; ok {
+				t.Errorf("%s reported twice", p.Name)
+			}
+			reported[p.Name] = i
+		}
+		if len(reported) != 4 {
+			t.Fatalf("got reports for %v, want base, commonNav, withBody1 and withBody2", reported)
+		}
+		if reported["base"] > reported["commonNav"] {
+			t.Error("commonNav reported before its base")
+		}
+		for _, name := range []string{"base", "commonNav"} {
+			if got := rec.count(EventMiss, name); got != 1 {
+				t.Errorf("%s parsed %d times, want 1", name, got)
+			}
+		}
+		if err := d.WarmErr(); err != nil {
+			t.Errorf("got WarmErr %v, want nil", err)
+		}
+	})
+
+	t.Run("aggregates failures", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		progress, err := d.Warm(context.Background(), []string{"base", "missing"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range drain(t, progress) {
+			if p.Name == "missing" && !errors.Is(p.Err, ErrSchematicNotFound) {
+				t.Errorf("got error %v for missing, want ErrSchematicNotFound", p.Err)
+			}
+		}
+
+		err = d.WarmErr()
+		if !errors.Is(err, ErrWarmFailed) || !errors.Is(err, ErrSchematicNotFound) {
+			t.Errorf("got WarmErr %v, want ErrWarmFailed wrapping ErrSchematicNotFound", err)
+		}
+		if strings.Contains(err.Error(), "base:") {
+			t.Errorf("got WarmErr %v, want only missing listed", err)
+		}
+	})
+
+	t.Run("reports every failing template", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "doppel")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		brokenPath := filepath.Join(dir, "broken.gohtml")
+		if err := ioutil.WriteFile(brokenPath, []byte(`{{define "body"}}unclosed`), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		broken := schematic.Clone()
+		broken["withBody1"].Filepaths = []string{brokenPath}
+		broken["withBody2"].Filepaths = []string{brokenPath}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := New(ctx, broken)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		progress, err := d.Warm(context.Background(), []string{"withBody1", "withBody2", "missing"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		drain(t, progress)
+
+		err = d.WarmErr()
+		if !errors.Is(err, ErrWarmFailed) {
+			t.Fatalf("got WarmErr %v, want ErrWarmFailed", err)
+		}
+		if got, want := failedTemplates(t, err), []string{"missing", "withBody1", "withBody2"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got errors for %v, want %v", got, want)
+		}
+	})
+
+	t.Run("closes the channel when ctx is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		release := make(chan struct{})
+		defer close(release)
+		slowOpen := OptionFunc(func(d *Doppel) {
+			d.open = func(string) (io.ReadCloser, error) {
+				return &slowReader{release}, nil
+			}
+		})
+		d, err := New(ctx, schematic, slowOpen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		warmCtx, warmCancel := context.WithCancel(context.Background())
+		progress, err := d.Warm(warmCtx, []string{"withBody1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		warmCancel()
+		if reports := drain(t, progress); len(reports) != 0 {
+			t.Errorf("got reports %v, want none", reports)
+		}
+		if err := d.WarmErr(); !errors.Is(err, ErrWarmFailed) || !errors.Is(err, context.Canceled) {
+			t.Errorf("got WarmErr %v, want ErrWarmFailed wrapping context.Canceled", err)
+		}
+	})
+
+	t.Run("fails after shutdown", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		d, err := New(ctx, schematic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		for range d.Heartbeat() {
+		}
+
+		if _, err := d.Warm(context.Background(), []string{"base"}); !errors.Is(err, ErrDoppelShutdown) {
+			t.Errorf("got error %v, want ErrDoppelShutdown", err)
+		}
+	})
+	t.Run("ValidateOnly discards the templates it parses", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		rec := &eventRecorder{}
+		d, err := New(ctx, schematic, WithEventHook(rec.record))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Get(context.Background(), "base"); err != nil {
+			t.Fatal(err)
+		}
+
+		progress, err := d.Warm(context.Background(), []string{"withBody1", "missing"}, ValidateOnly())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reports := drain(t, progress); len(reports) != 4 {
+			t.Errorf("got %d reports, want 4", len(reports))
+		}
+		if err := d.WarmErr(); !errors.Is(err, ErrSchematicNotFound) {
+			t.Errorf("got WarmErr %v, want ErrSchematicNotFound", err)
+		}
+
+		for name, want := range map[string]int{"base": 0, "commonNav": 1, "withBody1": 1, "missing": 1} {
+			if got := rec.count(EventEvict, name); got != want {
+				t.Errorf("%s evicted %d times, want %d", name, got, want)
+			}
+		}
+		if _, err := d.Get(context.Background(), "withBody1"); err != nil {
+			t.Fatal(err)
+		}
+		if got := rec.count(EventMiss, "withBody1"); got != 2 {
+			t.Errorf("withBody1 parsed %d times, want 2", got)
+		}
+	})
+}